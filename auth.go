@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Headers carrying the request signature
+const (
+	signatureTimestampHeader = "X-Claude-Monitor-Timestamp"
+	signatureNonceHeader     = "X-Claude-Monitor-Nonce"
+	signatureHeader          = "X-Claude-Monitor-Signature"
+)
+
+// authenticateRequest adds the bearer token and, when a signing secret is
+// configured, an HMAC-SHA256 signature over the request
+func authenticateRequest(req *http.Request, body []byte, token string, secret string) error {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if secret == "" {
+		return nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	nonceHex := hex.EncodeToString(nonce)
+
+	req.Header.Set(signatureTimestampHeader, timestamp)
+	req.Header.Set(signatureNonceHeader, nonceHex)
+	req.Header.Set(signatureHeader, "sha256="+signRequest(secret, req.Method, req.URL.Path, timestamp, nonceHex, body))
+
+	return nil
+}
+
+// signRequest computes the hex HMAC-SHA256 of the canonical request string:
+//
+//	timestamp \n nonce \n method \n path \n hex(sha256(body))
+//
+// The server recomputes it, rejects stale timestamps and remembers nonces
+// to refuse replays.
+func signRequest(secret string, method string, path string, timestamp string, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	canonical := timestamp + "\n" + nonce + "\n" + method + "\n" + path + "\n" + hex.EncodeToString(bodyHash[:])
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
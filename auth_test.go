@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSignRequest pins the canonical string documented in the README, so a
+// change to it can't go unnoticed by servers verifying signatures
+func TestSignRequest(t *testing.T) {
+	const want = "fe4e91daa2862171e98be2721fc4eb1b11b9e259ab833c00a64cd8425d3c5e49"
+	got := signRequest("s3cret", "POST", "/api/claude-usage/upload", "1700000000",
+		"00112233445566778899aabbccddeeff", []byte(`{"daily":[]}`))
+	if got != want {
+		t.Errorf("signRequest = %s, want %s", got, want)
+	}
+}
+
+// TestAuthenticateRequest checks the headers of a signed request
+func TestAuthenticateRequest(t *testing.T) {
+	body := []byte(`{"daily":[]}`)
+	nonces := make(map[string]bool)
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, "https://usage.example.com/api/claude-usage/upload?debug=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := time.Now().Unix()
+		if err := authenticateRequest(req, body, "token", "s3cret"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := req.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want Bearer token", got)
+		}
+		timestamp := req.Header.Get(signatureTimestampHeader)
+		if seconds, err := strconv.ParseInt(timestamp, 10, 64); err != nil || seconds < before || seconds > time.Now().Unix() {
+			t.Errorf("%s = %q, want the current Unix time", signatureTimestampHeader, timestamp)
+		}
+		nonce := req.Header.Get(signatureNonceHeader)
+		if len(nonce) != 32 || nonces[nonce] {
+			t.Errorf("%s = %q, want 16 new random bytes in hex", signatureNonceHeader, nonce)
+		}
+		nonces[nonce] = true
+
+		// The path is signed without the query string
+		want := "sha256=" + signRequest("s3cret", "POST", "/api/claude-usage/upload", timestamp, nonce, body)
+		if got := req.Header.Get(signatureHeader); got != want {
+			t.Errorf("%s = %s, want %s", signatureHeader, got, want)
+		}
+	}
+
+	// Without a secret there is no signature
+	req, _ := http.NewRequest(http.MethodPost, "https://usage.example.com/", nil)
+	if err := authenticateRequest(req, body, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range []string{"Authorization", signatureTimestampHeader, signatureNonceHeader, signatureHeader} {
+		if got := req.Header.Get(header); got != "" {
+			t.Errorf("%s = %q without a token or secret, want none", header, got)
+		}
+	}
+}
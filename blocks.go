@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// sessionBlockDuration is the length of a subscription usage window
+const sessionBlockDuration = 5 * time.Hour
+
+// HourlyStats holds one hour's usage
+type HourlyStats struct {
+	// Start of the hour in the configured timezone (RFC 3339)
+	Hour string `json:"hour"`
+	TokenTotals
+}
+
+// SessionBlock is a reconstructed 5-hour usage window. A block starts at the
+// hour of the first message after the previous block ended and lasts five
+// hours; hours without any message between blocks are idle time.
+type SessionBlock struct {
+	Start        string `json:"start"`
+	End          string `json:"end"`
+	FirstMessage string `json:"firstMessage"`
+	LastMessage  string `json:"lastMessage"`
+
+	// The current time falls inside the block
+	Active bool `json:"active"`
+
+	TokenTotals
+
+	// Per-model breakdown of the totals above, sorted by model name
+	Models []ModelStats `json:"models,omitempty"`
+
+	start time.Time
+	end   time.Time
+	last  time.Time
+}
+
+// aggregateHourly sums the final usage of each message into hours of loc,
+// sorted by time. Hours without usage are left out.
+func aggregateHourly(messageData map[string]*MessageDataEntry, pricing PricingTable, loc *time.Location) []HourlyStats {
+	hours := make(map[string]*HourlyStats)
+	for _, data := range messageData {
+		t := data.Timestamp.In(loc)
+		hour := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc).Format(time.RFC3339)
+
+		if hours[hour] == nil {
+			hours[hour] = &HourlyStats{Hour: hour}
+		}
+		hours[hour].add(data.Usage, pricing.cost(data.Model, data.Usage))
+	}
+
+	hourlyList := make([]HourlyStats, 0, len(hours))
+	for _, stats := range hours {
+		hourlyList = append(hourlyList, *stats)
+	}
+	sort.Slice(hourlyList, func(i, j int) bool {
+		return hourlyList[i].Hour < hourlyList[j].Hour
+	})
+	return hourlyList
+}
+
+// aggregateBlocks splits the messages into 5-hour blocks, oldest first
+func aggregateBlocks(messageData map[string]*MessageDataEntry, pricing PricingTable, loc *time.Location, now time.Time) []SessionBlock {
+	entries := make([]*MessageDataEntry, 0, len(messageData))
+	for _, data := range messageData {
+		entries = append(entries, data)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	var blocks []SessionBlock
+	var modelStats map[string]*ModelStats
+	finish := func() {
+		if len(blocks) > 0 {
+			blocks[len(blocks)-1].Models = sortedModelStats(modelStats)
+		}
+	}
+
+	for _, data := range entries {
+		if len(blocks) == 0 || !data.Timestamp.Before(blocks[len(blocks)-1].end) {
+			finish()
+
+			// Windows are reset on the hour, so a block starts at the full
+			// hour of its first message
+			start := data.Timestamp.Truncate(time.Hour)
+			blocks = append(blocks, SessionBlock{
+				start: start,
+				end:   start.Add(sessionBlockDuration),
+			})
+			modelStats = make(map[string]*ModelStats)
+		}
+
+		block := &blocks[len(blocks)-1]
+		if block.RequestCount == 0 {
+			block.FirstMessage = data.Timestamp.In(loc).Format(time.RFC3339)
+		}
+		block.last = data.Timestamp
+
+		cost := pricing.cost(data.Model, data.Usage)
+		block.add(data.Usage, cost)
+
+		model := data.Model
+		if model == "" {
+			model = unknownModel
+		}
+		getModelStats(modelStats, model).add(data.Usage, cost)
+	}
+	finish()
+
+	for i := range blocks {
+		block := &blocks[i]
+		block.Start = block.start.In(loc).Format(time.RFC3339)
+		block.End = block.end.In(loc).Format(time.RFC3339)
+		block.LastMessage = block.last.In(loc).Format(time.RFC3339)
+		block.Active = !now.Before(block.start) && now.Before(block.end)
+	}
+
+	return blocks
+}
+
+// BlocksOptions holds the flags of the blocks command
+type BlocksOptions struct {
+	Days int
+	JSON bool
+}
+
+func parseBlocksArgs(args []string) (*BlocksOptions, error) {
+	options := &BlocksOptions{Days: 7}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--days":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &options.Days)
+				i++
+			}
+		case "--json":
+			options.JSON = true
+		default:
+			return nil, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	if options.Days <= 0 {
+		return nil, fmt.Errorf("--days must be a positive number")
+	}
+	return options, nil
+}
+
+// handleBlocks shows the current 5-hour block and the blocks of recent days
+func handleBlocks() {
+	options, err := parseBlocksArgs(os.Args[2:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	config := loadConfigOrDefault()
+
+	usageData, err := collectUsageData(config)
+	if err != nil {
+		fmt.Printf("Error collecting data: %v\n", err)
+		os.Exit(1)
+	}
+
+	loc, err := config.getLocation()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	blocks := []SessionBlock{}
+	for _, block := range usageData.Blocks {
+		if now.Sub(block.end) < time.Duration(options.Days)*24*time.Hour {
+			blocks = append(blocks, block)
+		}
+	}
+
+	if options.JSON {
+		jsonData, err := json.MarshalIndent(blocks, "", "  ")
+		if err != nil {
+			fmt.Printf("Error marshaling JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	printCurrentBlock(blocks, now, loc)
+
+	if len(blocks) == 0 {
+		return
+	}
+
+	fmt.Printf("\nBlocks in the last %d days:\n", options.Days)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  Start\tLast message\tTokens\tRequests\tCost (USD)\t")
+	for _, block := range blocks {
+		status := ""
+		if block.Active {
+			status = "active"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t$%.2f\t%s\n",
+			block.start.In(loc).Format("2006-01-02 15:04"),
+			block.last.In(loc).Format("15:04"),
+			formatCount(block.TotalTokens),
+			block.RequestCount,
+			block.EstimatedCostUSD,
+			status)
+	}
+	w.Flush()
+}
+
+// printCurrentBlock summarizes the active block, if any
+func printCurrentBlock(blocks []SessionBlock, now time.Time, loc *time.Location) {
+	var block *SessionBlock
+	for i := range blocks {
+		if blocks[i].Active {
+			block = &blocks[i]
+		}
+	}
+	if block == nil {
+		fmt.Println("No active block; the next message starts a new 5-hour window")
+		return
+	}
+
+	fmt.Printf("Current block: %s - %s\n", block.start.In(loc).Format("15:04"), block.end.In(loc).Format("15:04"))
+	fmt.Printf("  Resets in: %s\n", formatDuration(block.end.Sub(now)))
+	fmt.Printf("  Tokens: %s (%d requests)\n", formatCount(block.TotalTokens), block.RequestCount)
+	fmt.Printf("  Estimated cost: $%.2f\n", block.EstimatedCostUSD)
+
+	// Burn rate over the time the block has been in use so far
+	elapsed := now.Sub(block.start)
+	if elapsed >= time.Minute {
+		perMinute := float64(block.TotalTokens) / elapsed.Minutes()
+		projected := block.TotalTokens + int64(perMinute*block.end.Sub(now).Minutes())
+		fmt.Printf("  Burn rate: %s tokens/min\n", formatCount(int64(perMinute)))
+		fmt.Printf("  Projected at reset: %s tokens\n", formatCount(projected))
+	}
+
+	if len(block.Models) > 0 {
+		models := make([]string, 0, len(block.Models))
+		for _, model := range block.Models {
+			models = append(models, fmt.Sprintf("%s %s", model.Model, formatCount(model.TotalTokens)))
+		}
+		fmt.Printf("  Models: %s\n", strings.Join(models, ", "))
+	}
+}
+
+// formatDuration renders d as hours and minutes, e.g. "2h 05m"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -1,7 +1,7 @@
 #!/bin/bash
 
 # Claude Monitor Build Script
-# Builds binaries for macOS (Intel/ARM) and Windows
+# Builds binaries for macOS (Intel/ARM), Linux and Windows
 
 set -e
 
@@ -25,6 +25,16 @@ echo "Building for macOS AMD64..."
 GOOS=darwin GOARCH=amd64 go build -ldflags="-s -w" -o "${OUTPUT_DIR}/${APP_NAME}-darwin-amd64" .
 echo "  -> ${OUTPUT_DIR}/${APP_NAME}-darwin-amd64"
 
+# Build for Linux AMD64
+echo "Building for Linux AMD64..."
+GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o "${OUTPUT_DIR}/${APP_NAME}-linux-amd64" .
+echo "  -> ${OUTPUT_DIR}/${APP_NAME}-linux-amd64"
+
+# Build for Linux ARM64
+echo "Building for Linux ARM64..."
+GOOS=linux GOARCH=arm64 go build -ldflags="-s -w" -o "${OUTPUT_DIR}/${APP_NAME}-linux-arm64" .
+echo "  -> ${OUTPUT_DIR}/${APP_NAME}-linux-arm64"
+
 # Build for Windows AMD64
 echo "Building for Windows AMD64..."
 GOOS=windows GOARCH=amd64 go build -ldflags="-s -w" -o "${OUTPUT_DIR}/${APP_NAME}-windows-amd64.exe" .
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointVersion is bumped whenever the parsed message state changes shape,
+// so stale checkpoints are discarded and every file is rescanned
+const checkpointVersion = 7
+
+// Checkpoint persists collection progress between cycles so only bytes
+// appended since the last run need to be parsed
+type Checkpoint struct {
+	Version  int                          `json:"version"`
+	Files    map[string]*FileCheckpoint   `json:"files"`
+	Messages map[string]*MessageDataEntry `json:"messages"`
+
+	// Every file holding a message that was found in more than one, e.g.
+	// a resumed or forked session that copied its history
+	Holders map[string][]string `json:"holders,omitempty"`
+
+	// Start of the collection window (UnixNano); older messages were skipped
+	WindowStart int64 `json:"windowStart"`
+}
+
+// FileCheckpoint records the state of a JSONL file when it was last parsed
+type FileCheckpoint struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Inode   uint64 `json:"inode"`
+	Offset  int64  `json:"offset"`
+}
+
+func getCheckpointPath() string {
+	return filepath.Join(getConfigDir(), "checkpoint.json")
+}
+
+func newCheckpoint() *Checkpoint {
+	return &Checkpoint{
+		Version:  checkpointVersion,
+		Files:    make(map[string]*FileCheckpoint),
+		Messages: make(map[string]*MessageDataEntry),
+		Holders:  make(map[string][]string),
+	}
+}
+
+// loadCheckpoint reads the checkpoint file, returning an empty checkpoint
+// if it is missing, unreadable or from an older version
+func loadCheckpoint() *Checkpoint {
+	data, err := os.ReadFile(getCheckpointPath())
+	if err != nil {
+		return newCheckpoint()
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil || checkpoint.Version != checkpointVersion {
+		return newCheckpoint()
+	}
+
+	if checkpoint.Files == nil {
+		checkpoint.Files = make(map[string]*FileCheckpoint)
+	}
+	if checkpoint.Messages == nil {
+		checkpoint.Messages = make(map[string]*MessageDataEntry)
+	}
+	if checkpoint.Holders == nil {
+		checkpoint.Holders = make(map[string][]string)
+	}
+
+	return &checkpoint
+}
+
+// saveCheckpoint writes the checkpoint atomically so a crash mid-write
+// never leaves a truncated file behind
+func saveCheckpoint(checkpoint *Checkpoint) error {
+	if err := os.MkdirAll(getConfigDir(), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(getCheckpointPath(), data)
+}
+
+// writeFileAtomic writes data to a new temporary file next to path and renames
+// it into place. The temporary name is unique, so a command collecting while
+// the daemon runs never writes into the daemon's temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+// resumeOffset returns the offset to continue parsing from, or 0 if the file
+// was truncated or replaced since it was last parsed
+func (fc *FileCheckpoint) resumeOffset(info os.FileInfo) int64 {
+	if fc == nil {
+		return 0
+	}
+
+	// A different inode means the file was replaced (e.g. rewritten via rename)
+	if fc.Inode != fileInode(info) {
+		return 0
+	}
+
+	// Shrinking means the file was truncated
+	if info.Size() < fc.Offset {
+		return 0
+	}
+
+	// Same size but a new mtime means it was rewritten in place
+	if info.Size() == fc.Size && info.ModTime().UnixNano() != fc.ModTime {
+		return 0
+	}
+
+	return fc.Offset
+}
+
+// isUnchanged reports whether the file is exactly as it was last parsed
+func (fc *FileCheckpoint) isUnchanged(info os.FileInfo) bool {
+	return fc != nil &&
+		fc.Inode == fileInode(info) &&
+		fc.Size == info.Size() &&
+		fc.ModTime == info.ModTime().UnixNano()
+}
+
+// dropFile removes the messages parsed from the given file. One that another
+// file still holds is kept, attributed to that file, since the other file
+// is unchanged and won't be parsed again.
+func (c *Checkpoint) dropFile(path string) {
+	delete(c.Files, path)
+	for key, entry := range c.Messages {
+		holders := c.removeHolder(key, path)
+		if entry.File != path {
+			continue
+		}
+		if len(holders) > 0 {
+			moved := *entry
+			moved.File = holders[len(holders)-1]
+			c.Messages[key] = &moved
+			continue
+		}
+		delete(c.Messages, key)
+	}
+}
+
+// addHolders records that the message is in each of files
+func (c *Checkpoint) addHolders(key string, files ...string) {
+	holders := c.Holders[key]
+	for _, file := range files {
+		if !containsString(holders, file) {
+			holders = append(holders, file)
+		}
+	}
+	if len(holders) > 1 {
+		c.Holders[key] = holders
+	}
+}
+
+// removeHolder forgets that path holds the message and returns the files
+// that still do, if it was in more than one
+func (c *Checkpoint) removeHolder(key string, path string) []string {
+	holders, ok := c.Holders[key]
+	if !ok {
+		return nil
+	}
+
+	remaining := make([]string, 0, len(holders))
+	for _, file := range holders {
+		if file != path {
+			remaining = append(remaining, file)
+		}
+	}
+	if len(remaining) > 1 {
+		c.Holders[key] = remaining
+	} else {
+		delete(c.Holders, key)
+	}
+	return remaining
+}
+
+// pruneBefore removes messages older than the cutoff time
+func (c *Checkpoint) pruneBefore(cutoffTime time.Time) {
+	for key, entry := range c.Messages {
+		if entry.Timestamp.Before(cutoffTime) {
+			delete(c.Messages, key)
+			delete(c.Holders, key)
+		}
+	}
+}
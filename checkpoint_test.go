@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupCollection points the config and projects directories at a new
+// temporary tree and returns the project directory for transcripts
+func setupCollection(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	projects := filepath.Join(home, "projects")
+	t.Setenv("CLAUDE_PROJECTS_DIR", projects)
+	project := filepath.Join(projects, "-home-dev-app")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+// collectLive runs one collection cycle over the last day
+func collectLive(t *testing.T) (map[string]*MessageDataEntry, Diagnostics) {
+	t.Helper()
+	var diagnostics Diagnostics
+	messages, err := collectLiveMessages(time.Now().Add(-24*time.Hour), &diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages, diagnostics
+}
+
+func appendFile(t *testing.T, path string, text string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// messageKeys lists the message keys, sorted, for comparing
+func messageKeys(messages map[string]*MessageDataEntry) string {
+	var keys []string
+	for key := range messages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// TestCheckpointResume checks that appended bytes are the only ones parsed,
+// and that a partial last line is read again once it is complete
+func TestCheckpointResume(t *testing.T) {
+	project := setupCollection(t)
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	path := filepath.Join(project, "session.jsonl")
+
+	first := assistantLine("m1", timestamp, 1) + "\n" + assistantLine("m2", timestamp, 2) + "\n"
+	if err := os.WriteFile(path, []byte(first), 0600); err != nil {
+		t.Fatal(err)
+	}
+	messages, diagnostics := collectLive(t)
+	if got := messageKeys(messages); got != "m1,m2" || diagnostics.BytesRead != int64(len(first)) {
+		t.Fatalf("first cycle: messages %s, %d bytes read; want m1,m2 and %d", got, diagnostics.BytesRead, len(first))
+	}
+
+	// Nothing changed: the file isn't opened at all
+	_, diagnostics = collectLive(t)
+	if diagnostics.FilesParsed != 0 || diagnostics.BytesRead != 0 {
+		t.Errorf("unchanged file: %d parsed, %d bytes read; want 0, 0", diagnostics.FilesParsed, diagnostics.BytesRead)
+	}
+
+	third := assistantLine("m3", timestamp, 3) + "\n"
+	fourth := assistantLine("m4", timestamp, 4)
+	// The partial line is read but the offset stays before it
+	partial := fourth[:len(fourth)/2]
+	appendFile(t, path, third+partial)
+	messages, diagnostics = collectLive(t)
+	if got := messageKeys(messages); got != "m1,m2,m3" || diagnostics.BytesRead != int64(len(third)+len(partial)) {
+		t.Errorf("after append: messages %s, %d bytes read; want m1,m2,m3 and %d", got, diagnostics.BytesRead, len(third)+len(partial))
+	}
+	if offset := loadCheckpoint().Files[path].Offset; offset != int64(len(first)+len(third)) {
+		t.Errorf("offset = %d, want %d before the partial line", offset, len(first)+len(third))
+	}
+
+	appendFile(t, path, fourth[len(partial):]+"\n")
+	messages, diagnostics = collectLive(t)
+	if got := messageKeys(messages); got != "m1,m2,m3,m4" || diagnostics.BytesRead != int64(len(fourth)+1) {
+		t.Errorf("after completing the line: messages %s, %d bytes read; want m1,m2,m3,m4 and %d", got, diagnostics.BytesRead, len(fourth)+1)
+	}
+	if entry := messages["m4"]; entry == nil || entry.Usage.OutputTokens != 4 {
+		t.Errorf("m4 = %+v", entry)
+	}
+}
+
+// TestCheckpointRewrite checks that a truncated or replaced file is read
+// again from the start, and its old messages are forgotten
+func TestCheckpointRewrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite func(t *testing.T, path string, content string)
+	}{
+		{"truncated", func(t *testing.T, path string, content string) {
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"replaced", func(t *testing.T, path string, content string) {
+			// A longer file with a new inode, so only the inode tells
+			replacement := path + ".tmp"
+			if err := os.WriteFile(replacement, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(replacement, path); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := setupCollection(t)
+			timestamp := time.Now().UTC().Format(time.RFC3339)
+			path := filepath.Join(project, "session.jsonl")
+
+			original := assistantLine("old1", timestamp, 1) + "\n" + assistantLine("old2", timestamp, 2) + "\n"
+			if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+				t.Fatal(err)
+			}
+			collectLive(t)
+
+			content := assistantLine("new", timestamp, 5) + "\n"
+			if tt.name == "replaced" {
+				content += assistantLine("new2", timestamp, 6) + "\n" + assistantLine("new3", timestamp, 7) + "\n"
+			}
+			tt.rewrite(t, path, content)
+
+			messages, diagnostics := collectLive(t)
+			if diagnostics.BytesRead != int64(len(content)) {
+				t.Errorf("read %d bytes, want the whole file of %d", diagnostics.BytesRead, len(content))
+			}
+			for key := range messages {
+				if strings.HasPrefix(key, "old") {
+					t.Errorf("message %s from the old contents is still counted", key)
+				}
+			}
+			if messages["new"] == nil {
+				t.Errorf("messages = %s, want the new contents", messageKeys(messages))
+			}
+		})
+	}
+}
+
+// TestCheckpointDeletedFile checks that a deleted file's messages are
+// dropped, except those another file still holds
+func TestCheckpointDeletedFile(t *testing.T) {
+	project := setupCollection(t)
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	original := filepath.Join(project, "original.jsonl")
+	resumed := filepath.Join(project, "resumed.jsonl")
+	other := filepath.Join(project, "other.jsonl")
+
+	writeTranscript(t, original, []string{assistantLine("shared", timestamp, 1), assistantLine("own", timestamp, 1)})
+	writeTranscript(t, other, []string{assistantLine("other", timestamp, 1)})
+	collectLive(t)
+
+	// A resumed session copies the history into a new file, parsed on a
+	// later cycle than the original
+	writeTranscript(t, resumed, []string{assistantLine("shared", timestamp, 1), assistantLine("next", timestamp, 1)})
+	collectLive(t)
+
+	// The message is attributed to the later file; deleting it must not
+	// lose the copy in the original, which is unchanged and not parsed again
+	if err := os.Remove(resumed); err != nil {
+		t.Fatal(err)
+	}
+	messages, _ := collectLive(t)
+	if got := messageKeys(messages); got != "other,own,shared" {
+		t.Errorf("after deleting the resumed session: messages %s, want other,own,shared", got)
+	}
+	if entry := messages["shared"]; entry == nil || entry.File != original {
+		t.Errorf("shared message = %+v, want it attributed to %s", entry, original)
+	}
+
+	if err := os.Remove(original); err != nil {
+		t.Fatal(err)
+	}
+	messages, _ = collectLive(t)
+	if got := messageKeys(messages); got != "other" {
+		t.Errorf("after deleting both copies: messages %s, want other", got)
+	}
+	if holders := loadCheckpoint().Holders; len(holders) != 0 {
+		t.Errorf("holders = %v, want none left", holders)
+	}
+}
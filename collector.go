@@ -3,9 +3,14 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,11 +18,14 @@ import (
 type ClaudeEntry struct {
 	Type      string        `json:"type"`
 	Timestamp string        `json:"timestamp"`
+	Cwd       string        `json:"cwd"`
+	SessionID string        `json:"sessionId"`
 	Message   ClaudeMessage `json:"message"`
 }
 
 type ClaudeMessage struct {
 	ID    string       `json:"id"`
+	Model string       `json:"model"`
 	Usage *ClaudeUsage `json:"usage,omitempty"`
 }
 
@@ -26,48 +34,217 @@ type ClaudeUsage struct {
 	OutputTokens             int `json:"output_tokens"`
 	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
 	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+
+	// Split of the cache write tokens by TTL, only present in newer transcripts
+	CacheCreation *ClaudeCacheCreation `json:"cache_creation,omitempty"`
+}
+
+type ClaudeCacheCreation struct {
+	Ephemeral5mInputTokens int `json:"ephemeral_5m_input_tokens"`
+	Ephemeral1hInputTokens int `json:"ephemeral_1h_input_tokens"`
+}
+
+// TokenTotals holds summed usage; embedded in every stats type so they all
+// share the same JSON field names
+type TokenTotals struct {
+	TotalInputTokens      int64 `json:"totalInputTokens"`
+	TotalOutputTokens     int64 `json:"totalOutputTokens"`
+	TotalCacheWriteTokens int64 `json:"totalCacheWriteTokens"`
+	TotalCacheReadTokens  int64 `json:"totalCacheReadTokens"`
+	TotalTokens           int64 `json:"totalTokens"`
+	RequestCount          int   `json:"requestCount"`
+
+	// Estimated from the pricing table; 0 for models without a price
+	EstimatedCostUSD float64 `json:"estimatedCostUSD"`
+}
+
+func (t *TokenTotals) add(usage *ClaudeUsage, cost float64) {
+	t.TotalInputTokens += int64(usage.InputTokens)
+	t.TotalOutputTokens += int64(usage.OutputTokens)
+	t.TotalCacheWriteTokens += int64(usage.CacheCreationInputTokens)
+	t.TotalCacheReadTokens += int64(usage.CacheReadInputTokens)
+	t.TotalTokens = t.TotalInputTokens + t.TotalOutputTokens +
+		t.TotalCacheWriteTokens + t.TotalCacheReadTokens
+	t.RequestCount++
+	t.EstimatedCostUSD = roundCost(t.EstimatedCostUSD + cost)
+}
+
+// merge adds already summed totals
+func (t *TokenTotals) merge(other TokenTotals) {
+	t.TotalInputTokens += other.TotalInputTokens
+	t.TotalOutputTokens += other.TotalOutputTokens
+	t.TotalCacheWriteTokens += other.TotalCacheWriteTokens
+	t.TotalCacheReadTokens += other.TotalCacheReadTokens
+	t.TotalTokens += other.TotalTokens
+	t.RequestCount += other.RequestCount
+	t.EstimatedCostUSD = roundCost(t.EstimatedCostUSD + other.EstimatedCostUSD)
 }
 
 // Daily stats structure
 type DailyStats struct {
-	Date                  string `json:"date"`
-	TotalInputTokens      int64  `json:"totalInputTokens"`
-	TotalOutputTokens     int64  `json:"totalOutputTokens"`
-	TotalCacheWriteTokens int64  `json:"totalCacheWriteTokens"`
-	TotalCacheReadTokens  int64  `json:"totalCacheReadTokens"`
-	TotalTokens           int64  `json:"totalTokens"`
-	RequestCount          int    `json:"requestCount"`
+	Date string `json:"date"`
+	TokenTotals
+
+	// Per-model breakdown of the totals above, sorted by model name
+	Models []ModelStats `json:"models,omitempty"`
+
+	// Per-project breakdown of the totals above, sorted by project
+	Projects []ProjectStats `json:"projects,omitempty"`
+}
+
+// ModelStats holds one model's share of a day's usage
+type ModelStats struct {
+	Model string `json:"model"`
+	TokenTotals
 }
 
+// ProjectStats holds one project's share of a day's usage
+type ProjectStats struct {
+	Project string `json:"project"`
+	TokenTotals
+
+	// Per-model breakdown within the project, sorted by model name
+	Models []ModelStats `json:"models,omitempty"`
+}
+
+// unknownModel is used for entries that don't name their model
+const unknownModel = "unknown"
+
+// unknownProject is used for transcripts outside any project directory
+const unknownProject = "unknown"
+
 // Upload payload
 type UsageData struct {
+	// Zone the days were cut in: an IANA name, or a UTC offset if unknown
+	Timezone string `json:"timezone,omitempty"`
+
+	// Set when Daily holds only the days that changed since the last upload;
+	// days left out are unchanged, not deleted
+	Partial bool `json:"partial,omitempty"`
+
 	Daily []DailyStats `json:"daily"`
+
+	// Hours with usage and reconstructed 5-hour blocks, oldest first
+	Hourly []HourlyStats  `json:"hourly,omitempty"`
+	Blocks []SessionBlock `json:"blocks,omitempty"`
+
+	// What this collection read; only the appended part of each transcript
+	// is read, so the line counts are not totals
+	diagnostics Diagnostics
 }
 
 // MessageDataEntry stores the last usage data for a message ID
 type MessageDataEntry struct {
-	DateStr string
-	Usage   *ClaudeUsage
+	Timestamp time.Time    `json:"timestamp"`
+	File      string       `json:"file"`
+	Project   string       `json:"project"`
+	Cwd       string       `json:"cwd,omitempty"`
+	Session   string       `json:"session,omitempty"`
+	Model     string       `json:"model"`
+	Usage     *ClaudeUsage `json:"usage"`
+}
+
+// collectMu serializes collection, since sinks run concurrently and share the checkpoint
+var collectMu sync.Mutex
+
+func collectUsageData(config *Config) (*UsageData, error) {
+	pricing, err := loadPricing(config.PricingFile)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := config.getLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	collectMu.Lock()
+	defer collectMu.Unlock()
+
+	start := time.Now()
+	var diagnostics Diagnostics
+	messageData, err := collectMessageData(config.getWindowStart(loc), &diagnostics)
+	if err != nil {
+		return nil, err
+	}
+	diagnostics.Duration = time.Since(start)
+
+	// Phase 2: Aggregate by date using the last usage values
+	return &UsageData{
+		Timezone:    timezoneName(loc),
+		Daily:       aggregateDaily(messageData, pricing, loc),
+		Hourly:      aggregateHourly(messageData, pricing, loc),
+		Blocks:      aggregateBlocks(messageData, pricing, loc, time.Now()),
+		diagnostics: diagnostics,
+	}, nil
+}
+
+// collectMessageData returns the final usage of every message since
+// windowStart, keyed by message ID: the live transcripts merged over the
+// usage history, so messages from deleted transcripts still count. The
+// entries are shared, so callers must hold collectMu while using them.
+func collectMessageData(windowStart time.Time, diagnostics *Diagnostics) (map[string]*MessageDataEntry, error) {
+	live, err := collectLiveMessages(windowStart, diagnostics)
+	if err != nil {
+		return nil, err
+	}
+
+	if usageHistory == nil {
+		usageHistory = newUsageHistory()
+	}
+
+	// A history that can't be read or written doesn't stop the collection,
+	// since live messages are retried on the next cycle. Usage in transcripts
+	// deleted before it works again is lost, though, so it is reported.
+	err = usageHistory.refresh()
+	if err == nil {
+		err = usageHistory.update(live)
+	}
+	if err != nil {
+		diagnostics.fileError(usageHistory.path, err)
+		log.Printf("Warning: usage history not updated: %v", err)
+	}
+
+	messageData := usageHistory.since(windowStart)
+	for key, entry := range live {
+		messageData[key] = entry
+	}
+	return messageData, nil
 }
 
-func collectUsageData() (*UsageData, error) {
+// collectLiveMessages brings the checkpoint up to date and returns the final
+// usage of every message since windowStart found in the transcripts. What
+// was read is added to diagnostics.
+func collectLiveMessages(windowStart time.Time, diagnostics *Diagnostics) (map[string]*MessageDataEntry, error) {
 	claudeDir := getClaudeProjectsDir()
 
 	// Check if directory exists
 	if _, err := os.Stat(claudeDir); os.IsNotExist(err) {
-		return &UsageData{Daily: []DailyStats{}}, nil
+		return map[string]*MessageDataEntry{}, nil
 	}
 
 	// Phase 1: Store last usage per message ID (streaming creates multiple entries, last one has final values)
 	// This matches the Python script logic: "Always overwrite - last entry has the final usage values"
-	messageData := make(map[string]*MessageDataEntry)
+	// The checkpoint carries this state between cycles so only appended bytes are parsed
+	checkpoint := loadCheckpoint()
+
+	// Messages before the saved window were never kept, so a window that
+	// grew (or moved with a new timezone) needs a full rescan
+	cutoffTime := windowStart
+	if checkpoint.WindowStart == 0 || cutoffTime.UnixNano() < checkpoint.WindowStart {
+		checkpoint = newCheckpoint()
+	}
+	checkpoint.WindowStart = cutoffTime.UnixNano()
+	checkpoint.pruneBefore(cutoffTime)
+	messageData := checkpoint.Messages
 
-	// Cutoff time (90 days)
-	cutoffTime := time.Now().UTC().AddDate(0, 0, -90)
+	seenFiles := make(map[string]bool)
+	var jobs []parseJob
 
 	// Find all JSONL files
 	err := filepath.Walk(claudeDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
+			diagnostics.fileError(path, err)
 			return nil // Skip errors
 		}
 
@@ -75,7 +252,21 @@ func collectUsageData() (*UsageData, error) {
 			return nil
 		}
 
-		processJSONLFile(path, messageData, cutoffTime)
+		seenFiles[path] = true
+		diagnostics.FilesScanned++
+
+		fileCheckpoint := checkpoint.Files[path]
+		if fileCheckpoint.isUnchanged(info) {
+			return nil
+		}
+
+		offset := fileCheckpoint.resumeOffset(info)
+		if offset == 0 && fileCheckpoint != nil {
+			// Truncated or replaced: forget what was parsed from it and start over
+			checkpoint.dropFile(path)
+		}
+
+		jobs = append(jobs, parseJob{path: path, project: projectFromPath(claudeDir, path), info: info, offset: offset})
 		return nil
 	})
 
@@ -83,28 +274,98 @@ func collectUsageData() (*UsageData, error) {
 		return nil, err
 	}
 
-	// Phase 2: Aggregate by date using the last usage values
+	parsed, holders := parseFiles(jobs, cutoffTime, diagnostics)
+	for key, entry := range parsed {
+		if previous, ok := messageData[key]; ok && previous.File != entry.File {
+			checkpoint.addHolders(key, previous.File, entry.File)
+		}
+		messageData[key] = entry
+	}
+	for key, files := range holders {
+		checkpoint.addHolders(key, files...)
+	}
+
+	diagnostics.FilesParsed += len(jobs)
+	for _, job := range jobs {
+		diagnostics.merge(job.diagnostics)
+		if job.err != nil {
+			diagnostics.fileError(job.path, job.err)
+			continue // Skip unreadable files, retry next cycle
+		}
+		checkpoint.Files[job.path] = &FileCheckpoint{
+			Size:    job.info.Size(),
+			ModTime: job.info.ModTime().UnixNano(),
+			Inode:   fileInode(job.info),
+			Offset:  job.newOffset,
+		}
+	}
+
+	// Files that disappeared no longer contribute usage
+	for path := range checkpoint.Files {
+		if !seenFiles[path] {
+			checkpoint.dropFile(path)
+		}
+	}
+
+	// A failed save only costs a full rescan on the next cycle
+	saveCheckpoint(checkpoint)
+
+	return messageData, nil
+}
+
+// aggregateDaily sums the final usage of each message into per-day stats
+// with per-model and per-project breakdowns and estimated cost, sorted by date.
+// Days are cut in loc.
+func aggregateDaily(messageData map[string]*MessageDataEntry, pricing PricingTable, loc *time.Location) []DailyStats {
+	projectPaths := resolveProjectPaths(messageData)
+
 	dailyStatsMap := make(map[string]*DailyStats)
+	modelStatsMap := make(map[string]map[string]*ModelStats)
+	projectStatsMap := make(map[string]map[string]*ProjectStats)
+	projectModelStatsMap := make(map[string]map[string]map[string]*ModelStats)
 	for _, data := range messageData {
-		dateStr := data.DateStr
+		dateStr := data.Timestamp.In(loc).Format("2006-01-02")
 		usage := data.Usage
+		cost := pricing.cost(data.Model, usage)
 
 		if dailyStatsMap[dateStr] == nil {
 			dailyStatsMap[dateStr] = &DailyStats{Date: dateStr}
+			modelStatsMap[dateStr] = make(map[string]*ModelStats)
+			projectStatsMap[dateStr] = make(map[string]*ProjectStats)
+			projectModelStatsMap[dateStr] = make(map[string]map[string]*ModelStats)
 		}
+		dailyStatsMap[dateStr].add(usage, cost)
 
-		dailyStatsMap[dateStr].TotalInputTokens += int64(usage.InputTokens)
-		dailyStatsMap[dateStr].TotalOutputTokens += int64(usage.OutputTokens)
-		dailyStatsMap[dateStr].TotalCacheWriteTokens += int64(usage.CacheCreationInputTokens)
-		dailyStatsMap[dateStr].TotalCacheReadTokens += int64(usage.CacheReadInputTokens)
-		dailyStatsMap[dateStr].RequestCount++
+		model := data.Model
+		if model == "" {
+			model = unknownModel
+		}
+		getModelStats(modelStatsMap[dateStr], model).add(usage, cost)
+
+		project := projectPaths[data.Project]
+		projectStats := projectStatsMap[dateStr][project]
+		if projectStats == nil {
+			projectStats = &ProjectStats{Project: project}
+			projectStatsMap[dateStr][project] = projectStats
+			projectModelStatsMap[dateStr][project] = make(map[string]*ModelStats)
+		}
+		projectStats.add(usage, cost)
+		getModelStats(projectModelStatsMap[dateStr][project], model).add(usage, cost)
 	}
 
 	// Convert map to sorted slice
-	var dailyList []DailyStats
-	for _, stats := range dailyStatsMap {
-		stats.TotalTokens = stats.TotalInputTokens + stats.TotalOutputTokens +
-			stats.TotalCacheWriteTokens + stats.TotalCacheReadTokens
+	dailyList := []DailyStats{}
+	for dateStr, stats := range dailyStatsMap {
+		stats.Models = sortedModelStats(modelStatsMap[dateStr])
+
+		for project, projectStats := range projectStatsMap[dateStr] {
+			projectStats.Models = sortedModelStats(projectModelStatsMap[dateStr][project])
+			stats.Projects = append(stats.Projects, *projectStats)
+		}
+		sort.Slice(stats.Projects, func(i, j int) bool {
+			return stats.Projects[i].Project < stats.Projects[j].Project
+		})
+
 		dailyList = append(dailyList, *stats)
 	}
 
@@ -112,26 +373,211 @@ func collectUsageData() (*UsageData, error) {
 		return dailyList[i].Date < dailyList[j].Date
 	})
 
-	return &UsageData{Daily: dailyList}, nil
+	return dailyList
+}
+
+// getModelStats returns the entry for model, creating it if needed
+func getModelStats(modelStats map[string]*ModelStats, model string) *ModelStats {
+	stats := modelStats[model]
+	if stats == nil {
+		stats = &ModelStats{Model: model}
+		modelStats[model] = stats
+	}
+	return stats
+}
+
+// sortedModelStats flattens the map into a slice sorted by model name
+func sortedModelStats(modelStats map[string]*ModelStats) []ModelStats {
+	list := make([]ModelStats, 0, len(modelStats))
+	for _, stats := range modelStats {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Model < list[j].Model
+	})
+	return list
+}
+
+// parseJob is one file to parse, and the outcome
+type parseJob struct {
+	path    string
+	project string
+	info    os.FileInfo
+	offset  int64
+
+	newOffset   int64
+	diagnostics Diagnostics
+	err         error
 }
 
-func processJSONLFile(path string, messageData map[string]*MessageDataEntry, cutoffTime time.Time) {
+// parsedEntry remembers which job a message came from, so merging can
+// apply "last entry wins" in the same order as a serial scan
+type parsedEntry struct {
+	entry *MessageDataEntry
+	job   int
+
+	// Every file the message was found in, if more than one
+	files []string
+}
+
+// holders returns the files the message was found in
+func (p parsedEntry) holders() []string {
+	if p.files == nil {
+		return []string{p.entry.File}
+	}
+	return p.files
+}
+
+// mergeParsed combines two finds of one message: the later job's entry
+// wins, and the files of both are kept
+func mergeParsed(previous parsedEntry, next parsedEntry) parsedEntry {
+	merged := next
+	if previous.job > next.job {
+		merged = previous
+	}
+	merged.files = previous.holders()
+	for _, file := range next.holders() {
+		if !containsString(merged.files, file) {
+			merged.files = append(merged.files, file)
+		}
+	}
+	return merged
+}
+
+// maxParseWorkers bounds how many files are parsed at once. A variable so
+// the benchmark can compare the pool against a serial scan.
+var maxParseWorkers = 8
+
+// parseFiles parses the jobs concurrently and returns the messages found.
+// Each worker fills its own map; when a message appears in several files,
+// the one from the latest job wins, exactly as if the files had been parsed
+// one after another in job order. Such repeats are counted in diagnostics,
+// and the files holding them are returned by message.
+func parseFiles(jobs []parseJob, cutoffTime time.Time, diagnostics *Diagnostics) (map[string]*MessageDataEntry, map[string][]string) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > maxParseWorkers {
+		workers = maxParseWorkers
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	next := make(chan int)
+	results := make([]map[string]parsedEntry, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		results[w] = make(map[string]parsedEntry)
+		wg.Add(1)
+		go func(found map[string]parsedEntry) {
+			defer wg.Done()
+			for i := range next {
+				job := &jobs[i]
+				fileData := make(map[string]*MessageDataEntry)
+				job.newOffset, job.err = processJSONLFile(job.path, job.project, job.offset, fileData, cutoffTime, &job.diagnostics)
+				for key, entry := range fileData {
+					parsed := parsedEntry{entry: entry, job: i}
+					if previous, ok := found[key]; ok {
+						job.diagnostics.DuplicateMessages++
+						parsed = mergeParsed(previous, parsed)
+					}
+					found[key] = parsed
+				}
+			}
+		}(results[w])
+	}
+
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	merged := make(map[string]parsedEntry)
+	for _, found := range results {
+		for key, parsed := range found {
+			if previous, ok := merged[key]; ok {
+				diagnostics.DuplicateMessages++
+				parsed = mergeParsed(previous, parsed)
+			}
+			merged[key] = parsed
+		}
+	}
+
+	messageData := make(map[string]*MessageDataEntry, len(merged))
+	holders := make(map[string][]string)
+	for key, parsed := range merged {
+		messageData[key] = parsed.entry
+		if parsed.files != nil {
+			holders[key] = parsed.files
+		}
+	}
+	return messageData, holders
+}
+
+// processJSONLFile parses the file starting at offset and returns the offset
+// just past the last complete line. Lines of any length are handled: those
+// over maxLineBytes are streamed, keeping only the fields that are needed.
+// What was read and skipped is added to diagnostics.
+func processJSONLFile(path string, project string, offset int64, messageData map[string]*MessageDataEntry, cutoffTime time.Time, diagnostics *Diagnostics) (int64, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return
+		return offset, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	// Increase buffer size for large lines
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return offset, err
+		}
+	}
+
+	// Transcripts are named after their session; older ones lack sessionId
+	fileSession := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var buf []byte
+
+	for {
+		line, long, err := readLine(reader, buf)
+		if err != nil && err != io.EOF {
+			return offset, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		buf = line
 
 		var entry ClaudeEntry
-		if err := json.Unmarshal(line, &entry); err != nil {
+		var decodeErr error
+		var size int64
+		var complete bool
+		if long {
+			rest := &longLine{prefix: line, r: reader}
+			decodeErr = decodeLongLine(rest, &entry)
+			size, complete = rest.size(), rest.complete
+			diagnostics.LongLines++
+		} else {
+			decodeErr = json.Unmarshal(line, &entry)
+			size, complete = int64(len(line)), line[len(line)-1] == '\n'
+		}
+
+		// A line without a newline may still be being written. Parse it anyway
+		// but don't advance past it, so it is read again once complete.
+		diagnostics.BytesRead += size
+		if complete {
+			offset += size
+			diagnostics.Lines++
+		}
+
+		// Only complete lines count as skipped; a partial one is read again
+		skip := func(reason string) {
+			if complete {
+				diagnostics.skip(reason)
+			}
+		}
+
+		if decodeErr != nil {
+			skip(skipInvalidJSON)
 			continue
 		}
 
@@ -142,6 +588,7 @@ func processJSONLFile(path string, messageData map[string]*MessageDataEntry, cut
 
 		// Parse timestamp
 		if entry.Timestamp == "" {
+			skip(skipMissingTimestamp)
 			continue
 		}
 
@@ -150,6 +597,7 @@ func processJSONLFile(path string, messageData map[string]*MessageDataEntry, cut
 			// Try alternative format
 			msgTime, err = time.Parse("2006-01-02T15:04:05.000Z", entry.Timestamp)
 			if err != nil {
+				skip(skipBadTimestamp)
 				continue
 			}
 		}
@@ -159,12 +607,10 @@ func processJSONLFile(path string, messageData map[string]*MessageDataEntry, cut
 			continue
 		}
 
-		// Get date string for grouping
-		dateStr := msgTime.Format("2006-01-02")
-
 		// Check usage data (skip if usage is nil/empty - matches Python's "if not usage")
 		usage := entry.Message.Usage
 		if usage == nil {
+			skip(skipMissingUsage)
 			continue
 		}
 
@@ -176,11 +622,27 @@ func processJSONLFile(path string, messageData map[string]*MessageDataEntry, cut
 			key = "no_id_" + entry.Timestamp
 		}
 
+		session := entry.SessionID
+		if session == "" {
+			session = fileSession
+		}
+
+		if _, ok := messageData[key]; ok && complete {
+			diagnostics.DuplicateMessages++
+		}
+
 		// Always overwrite - last entry has the final usage values
 		// This matches Python: "Always overwrite - last entry has the final usage values"
 		messageData[key] = &MessageDataEntry{
-			DateStr: dateStr,
-			Usage:   usage,
+			Timestamp: msgTime,
+			File:      path,
+			Project:   project,
+			Cwd:       entry.Cwd,
+			Session:   session,
+			Model:     entry.Message.Model,
+			Usage:     usage,
 		}
 	}
+
+	return offset, nil
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// assistantLine returns a transcript line for one assistant message
+func assistantLine(id string, timestamp string, outputTokens int) string {
+	return fmt.Sprintf(`{"type":"assistant","timestamp":%q,"sessionId":"s","cwd":"/home/dev/app","message":{"id":%q,"model":"claude-sonnet-4-5","usage":{"input_tokens":10,"output_tokens":%d,"cache_creation_input_tokens":3,"cache_read_input_tokens":4}}}`,
+		timestamp, id, outputTokens)
+}
+
+// writeTranscript writes lines to path, one per line, and returns the job
+// that parses it from the start
+func writeTranscript(tb testing.TB, path string, lines []string) parseJob {
+	tb.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		tb.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return parseJob{path: path, project: "-home-dev-app", info: info}
+}
+
+// setParseWorkers lets parseFiles use up to workers goroutines and returns
+// a function restoring the previous limits
+func setParseWorkers(workers int) func() {
+	previousMax := maxParseWorkers
+	previousProcs := runtime.GOMAXPROCS(workers)
+	maxParseWorkers = workers
+	return func() {
+		maxParseWorkers = previousMax
+		runtime.GOMAXPROCS(previousProcs)
+	}
+}
+
+// TestParseFilesLaterFileWins checks that a message repeated across files
+// keeps the entry of the last file, with any number of workers
+func TestParseFilesLaterFileWins(t *testing.T) {
+	dir := t.TempDir()
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+
+	const files = 12
+	var jobs []parseJob
+	for i := 0; i < files; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%02d.jsonl", i))
+		jobs = append(jobs, writeTranscript(t, path, []string{
+			assistantLine("shared", timestamp, i+1),
+			assistantLine(fmt.Sprintf("own-%d", i), timestamp, 1),
+		}))
+	}
+
+	for _, workers := range []int{1, 4, maxParseWorkers} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			defer setParseWorkers(workers)()
+
+			parsed := append([]parseJob(nil), jobs...)
+			var diagnostics Diagnostics
+			messages, holders := parseFiles(parsed, time.Time{}, &diagnostics)
+			for _, job := range parsed {
+				if job.err != nil {
+					t.Fatalf("%s: %v", job.path, job.err)
+				}
+				diagnostics.merge(job.diagnostics)
+			}
+
+			if len(messages) != files+1 {
+				t.Errorf("got %d messages, want %d", len(messages), files+1)
+			}
+			shared := messages["shared"]
+			if shared == nil {
+				t.Fatal("shared message missing")
+			}
+			if shared.File != jobs[files-1].path || shared.Usage.OutputTokens != files {
+				t.Errorf("shared message from %s with %d output tokens, want %s with %d",
+					shared.File, shared.Usage.OutputTokens, jobs[files-1].path, files)
+			}
+			if len(holders) != 1 || len(holders["shared"]) != files {
+				t.Errorf("holders = %v, want all %d files for the shared message", holders, files)
+			}
+			if diagnostics.DuplicateMessages != files-1 {
+				t.Errorf("counted %d duplicates, want %d", diagnostics.DuplicateMessages, files-1)
+			}
+		})
+	}
+}
+
+// BenchmarkCollectCorpus parses a synthetic corpus serially and with the
+// worker pool. The pool is faster only with more than one CPU, e.g.
+// go test -bench CollectCorpus -cpu 1,4
+func BenchmarkCollectCorpus(b *testing.B) {
+	dir := b.TempDir()
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+
+	// Tool results make most of a real transcript's bytes
+	toolResult := fmt.Sprintf(`{"type":"user","timestamp":%q,"message":{"role":"user","content":[{"type":"tool_result","content":%q}]}}`,
+		timestamp, strings.Repeat("x", 2000))
+
+	var jobs []parseJob
+	var size int64
+	for i := 0; i < 64; i++ {
+		var lines []string
+		for j := 0; j < 500; j++ {
+			lines = append(lines, toolResult, assistantLine(fmt.Sprintf("msg-%d-%d", i, j), timestamp, j))
+		}
+		job := writeTranscript(b, filepath.Join(dir, fmt.Sprintf("%02d.jsonl", i)), lines)
+		size += job.info.Size()
+		jobs = append(jobs, job)
+	}
+
+	for _, workers := range []int{1, maxParseWorkers} {
+		name := "pool"
+		if workers == 1 {
+			name = "serial"
+		}
+		b.Run(name, func(b *testing.B) {
+			previous := maxParseWorkers
+			maxParseWorkers = workers
+			defer func() { maxParseWorkers = previous }()
+
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				var diagnostics Diagnostics
+				parseFiles(append([]parseJob(nil), jobs...), time.Time{}, &diagnostics)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
 	"time"
 )
@@ -22,9 +23,16 @@ func handleInstall() {
 	}
 
 	fmt.Println("Installing Claude Monitor service...")
-	fmt.Printf("  Email: %s\n", config.Email)
-	fmt.Printf("  Server: %s\n", config.ServerURL)
-	fmt.Printf("  Interval: %d seconds (%d minutes)\n", config.IntervalSeconds, config.IntervalSeconds/60)
+	printConfigSummary(config)
+
+	// Fail now rather than on every upload
+	if err := validateConfig(config); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, warning := range transportWarnings(config) {
+		fmt.Printf("Warning: %s\n", warning)
+	}
 
 	// Install service
 	if err := installService(config); err != nil {
@@ -37,6 +45,53 @@ func handleInstall() {
 	fmt.Printf("Log file: %s\n", getLogPath())
 }
 
+// printConfigSummary prints the effective settings without revealing secrets
+func printConfigSummary(config *Config) {
+	fmt.Printf("  Email: %s\n", config.Email)
+	fmt.Printf("  Server: %s\n", config.ServerURL)
+	fmt.Printf("  Interval: %d seconds (%d minutes)\n", config.IntervalSeconds, config.IntervalSeconds/60)
+	if config.HashProjectPaths {
+		fmt.Println("  Project paths: uploaded as salted hashes")
+	}
+	if config.PricingFile != "" {
+		fmt.Printf("  Pricing: %s\n", config.PricingFile)
+	}
+	if config.getAPIToken() != "" {
+		fmt.Println("  API token: set")
+	}
+	if config.getSigningSecret() != "" {
+		fmt.Println("  Request signing: enabled")
+	}
+	if config.CACertFile != "" {
+		fmt.Printf("  CA certificate: %s\n", config.CACertFile)
+	}
+	if config.ClientCertFile != "" {
+		fmt.Printf("  Client certificate: %s\n", config.ClientCertFile)
+	}
+	if config.HTTPProxy != "" || config.HTTPSProxy != "" {
+		fmt.Printf("  Proxy: http=%s https=%s\n", config.HTTPProxy, config.HTTPSProxy)
+	}
+	if config.MetricsAddr != "" {
+		fmt.Printf("  Metrics: http://%s/metrics\n", config.MetricsAddr)
+	}
+	if config.Timezone != "" {
+		fmt.Printf("  Timezone: %s\n", config.Timezone)
+	}
+	if len(config.Sinks) > 0 {
+		if sinkConfigs, err := getSinkConfigs(config); err == nil {
+			for _, sinkConfig := range sinkConfigs {
+				target := sinkConfig.ServerURL
+				if sinkConfig.Type == "file" {
+					target = sinkConfig.Path
+				} else if target == "" {
+					target = config.ServerURL
+				}
+				fmt.Printf("  Sink: %s (%s -> %s, every %d seconds)\n", sinkConfig.Name, sinkConfig.Type, target, sinkConfig.IntervalSeconds)
+			}
+		}
+	}
+}
+
 func handleUninstall() {
 	fmt.Println("Uninstalling Claude Monitor service...")
 
@@ -52,15 +107,32 @@ func handleStatus() {
 	fmt.Println("Claude Monitor Status")
 	fmt.Println("=====================")
 
+	// A daemon started with 'run' answers even without the service
+	daemonStatus, daemonErr := queryDaemonStatus()
+
+	if pid, alive := lockHolder(); alive {
+		fmt.Printf("Running instance: PID %d (%s)\n", pid, getLockPath())
+	} else if pid != 0 {
+		fmt.Printf("Running instance: none (stale lock from PID %d)\n", pid)
+	}
+
 	// Check if installed
 	if !isServiceInstalled() {
 		fmt.Println("Status: Not installed")
+		if daemonErr == nil {
+			printDaemonStatus(daemonStatus)
+		}
 		fmt.Println("\nRun 'claude-monitor install --email your@email.com' to install")
 		return
 	}
 
 	// Show service status
 	fmt.Printf("Service: %s\n", getServiceStatus())
+	if daemonErr == nil {
+		printDaemonStatus(daemonStatus)
+	} else {
+		fmt.Println("Daemon: not responding (not running, or started by an older version)")
+	}
 
 	// Load and show config
 	config, err := loadConfig()
@@ -68,9 +140,9 @@ func handleStatus() {
 		fmt.Printf("Config: Error loading (%v)\n", err)
 	} else {
 		fmt.Printf("\nConfiguration:\n")
-		fmt.Printf("  Email: %s\n", config.Email)
-		fmt.Printf("  Server: %s\n", config.ServerURL)
-		fmt.Printf("  Interval: %d seconds (%d minutes)\n", config.IntervalSeconds, config.IntervalSeconds/60)
+		printConfigSummary(config)
+
+		printEstimatedCost(config, daemonStatus)
 	}
 
 	// Show log file path
@@ -82,15 +154,92 @@ func handleStatus() {
 		fmt.Printf("Log size: %d bytes\n", info.Size())
 		fmt.Printf("Last modified: %s\n", info.ModTime().Format("2006-01-02 15:04:05"))
 	}
+
+	// Show payloads waiting for retry
+	if config != nil {
+		if sinkConfigs, err := getSinkConfigs(config); err == nil {
+			for _, sinkConfig := range sinkConfigs {
+				spool := newSpool(config, sinkConfig.Name)
+				if pending, err := spool.list(); err == nil && len(pending) > 0 {
+					fmt.Printf("Spooled payloads (%s): %d (waiting for retry in %s)\n", sinkConfig.Name, len(pending), spool.dir)
+				}
+			}
+		}
+	}
+}
+
+// printEstimatedCost shows the cost of today and the last 30 days without
+// collecting, since status must not write the daemon's state files. The
+// daemon's last collection is used when it answers; otherwise the
+// transcripts are scanned read-only, which misses usage kept only in the
+// history after its transcript was deleted.
+func printEstimatedCost(config *Config, daemonStatus *DaemonStatus) {
+	loc, err := config.getLocation()
+	if err != nil {
+		loc = time.Local
+	}
+
+	var costs map[string]float64
+	source := "last collection of the daemon"
+	if daemonStatus != nil && daemonStatus.LastCollection != nil && daemonStatus.LastCollection.DailyCostUSD != nil {
+		costs = daemonStatus.LastCollection.DailyCostUSD
+	} else {
+		pricing, err := loadPricing(config.PricingFile)
+		if err != nil {
+			fmt.Printf("\nEstimated cost: Error loading pricing (%v)\n", err)
+			return
+		}
+		watcher := newUsageWatcher(config.getWindowStart(loc))
+		watcher.scan()
+		costs = dailyCosts(aggregateDaily(watcher.messages, pricing, loc))
+		source = "transcripts on disk"
+	}
+
+	today := time.Now().In(loc).Format("2006-01-02")
+	monthAgo := time.Now().In(loc).AddDate(0, 0, -30).Format("2006-01-02")
+	var todayCost, monthCost float64
+	for date, cost := range costs {
+		if date == today {
+			todayCost += cost
+		}
+		if date > monthAgo {
+			monthCost += cost
+		}
+	}
+	fmt.Printf("\nEstimated cost (%s):\n", source)
+	fmt.Printf("  Today: $%.2f\n", todayCost)
+	fmt.Printf("  Last 30 days: $%.2f\n", monthCost)
 }
 
 func handleRun() {
 	args := os.Args[2:]
 
-	// Get or create config (loads existing, or prompts user)
-	config, err := getOrCreateConfig(args)
+	// Only one instance may upload at a time; --force stops the other one
+	force := containsString(args, "--force")
+	lock, err := acquireRunLock(force)
+	if held, ok := err.(*LockHeldError); ok && !isatty(os.Stdin.Fd()) {
+		// Started by the service manager while another instance runs, e.g.
+		// one that took over with --force. Exiting would only make the
+		// manager start it again, so wait and take over when that one exits.
+		lock, err = waitForRunLock(held, log.New(os.Stdout, "", log.LstdFlags))
+		if err == errLockWaitInterrupted {
+			return
+		}
+	}
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
+		if _, held := err.(*LockHeldError); held {
+			fmt.Println("Stop it first, or use 'claude-monitor run --force' to take over")
+		}
+		os.Exit(1)
+	}
+	defer lock.release()
+
+	// Flags override the config file for this run only
+	config, err := loadRunConfig(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		lock.release()
 		os.Exit(1)
 	}
 
@@ -116,55 +265,128 @@ func handleRun() {
 		logger = log.New(os.Stdout, "", log.LstdFlags)
 	}
 
+	sinkConfigs, sinks, err := newSinks(config)
+	if err != nil {
+		logger.Printf("Error: %v", err)
+		lock.release()
+		os.Exit(1)
+	}
+
 	logger.Printf("Claude Monitor started")
 	logger.Printf("  Email: %s", config.Email)
 	logger.Printf("  Server: %s", config.ServerURL)
 	logger.Printf("  Interval: %d seconds", config.IntervalSeconds)
 	logger.Printf("  Projects dir: %s", getClaudeProjectsDir())
+	for _, sinkConfig := range sinkConfigs {
+		logger.Printf("  Sink: %s (%s, every %d seconds)", sinkConfig.Name, sinkConfig.Type, sinkConfig.IntervalSeconds)
+	}
 
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Initial upload
-	logger.Println("Performing initial upload...")
-	result, err := uploadUsageData(config)
-	if err != nil {
-		logger.Printf("Initial upload error: %v", err)
-	} else {
-		logger.Printf("Initial upload: %s", result.Message)
+	// SIGUSR1 (where it exists) uploads right away, SIGHUP reloads the config
+	syncChan := make(chan os.Signal, 1)
+	notifySyncSignal(syncChan)
+	reloadChan := make(chan os.Signal, 1)
+	notifyReloadSignal(reloadChan)
+
+	live := &liveConfig{config: config}
+	state := newDaemonState()
+	if config.MetricsAddr != "" {
+		metricsServer := startMetricsServer(config.MetricsAddr, live, state, logger)
+		defer metricsServer.Close()
+		logger.Printf("  Metrics: http://%s/metrics", config.MetricsAddr)
 	}
 
-	// Start periodic upload loop
-	ticker := time.NewTicker(time.Duration(config.IntervalSeconds) * time.Second)
-	defer ticker.Stop()
+	// Each sink uploads on its own schedule
+	sinkLoops := newSinkSet(logger, state)
+	sinkLoops.start(config, sinkConfigs, sinks)
 
-	uploadCount := 1
+	// status and sync talk to the daemon through the control socket
+	if controlServer, err := startControlServer(state, sinkLoops.sync, logger); err != nil {
+		logger.Printf("Warning: control socket unavailable: %v", err)
+	} else {
+		defer controlServer.Close()
+		logger.Printf("  Control: %s", getControlPath())
+	}
 
+	// Edits to the config file are picked up like SIGHUP
+	configStamp := statConfigFile()
+	configPoll := time.NewTicker(configPollInterval)
+	defer configPoll.Stop()
+
+	// A reload waits for uploads in progress before the new sinks start,
+	// which can take minutes of retries, so reloads run one at a time in
+	// their own goroutine and this loop keeps handling signals
+	reloads := make(chan struct{}, 1)
+	go func() {
+		for range reloads {
+			reloadConfig(live, sinkLoops, args, logger)
+		}
+	}()
+	requestReload := func() {
+		select {
+		case reloads <- struct{}{}:
+		default:
+			// One is already queued, and it reads the file as it is then
+		}
+	}
+
+loop:
 	for {
 		select {
-		case <-ticker.C:
-			uploadCount++
-			logger.Printf("Upload #%d starting...", uploadCount)
-			result, err := uploadUsageData(config)
-			if err != nil {
-				logger.Printf("Upload #%d error: %v", uploadCount, err)
-			} else {
-				logger.Printf("Upload #%d: %s", uploadCount, result.Message)
+		case sig := <-syncChan:
+			logger.Printf("Received signal: %v, uploading now", sig)
+			go sinkLoops.sync()
+		case sig := <-reloadChan:
+			logger.Printf("Received signal: %v, reloading config", sig)
+			configStamp = statConfigFile()
+			requestReload()
+		case <-configPoll.C:
+			if stamp := statConfigFile(); stamp != configStamp {
+				configStamp = stamp
+				logger.Printf("Config file changed, reloading")
+				requestReload()
 			}
-
 		case sig := <-sigChan:
 			logger.Printf("Received signal: %v", sig)
-			logger.Println("Performing final upload...")
-			result, err := uploadUsageData(config)
-			if err != nil {
-				logger.Printf("Final upload error: %v", err)
-			} else {
-				logger.Printf("Final upload: %s", result.Message)
-			}
-			logger.Printf("Claude Monitor stopped (total uploads: %d)", uploadCount)
-			return
+			break loop
+		}
+	}
+	close(reloads)
+	sinkLoops.shutdown()
+	logger.Printf("Claude Monitor stopped")
+}
+
+// handleSync asks the running daemon to upload to every sink now and waits
+// for the results
+func handleSync() {
+	// Check first, so a missing daemon is reported right away
+	if _, err := queryDaemonStatus(); err != nil {
+		fmt.Println("Error: the daemon is not running (or was started by an older version)")
+		fmt.Println("Start it with 'claude-monitor install', or run 'claude-monitor run' in a terminal")
+		os.Exit(1)
+	}
+
+	fmt.Println("Uploading...")
+	results, err := requestSync()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, result := range results {
+		outcome := "OK"
+		if !result.Success {
+			outcome = "FAILED"
+			failed = true
 		}
+		fmt.Printf("[%s] %s: %s\n", result.Sink, outcome, result.Message)
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
 
@@ -173,7 +395,9 @@ func handleTest() {
 	fmt.Println("Test mode: Collecting usage data without uploading...")
 	fmt.Printf("Projects dir: %s\n", getClaudeProjectsDir())
 
-	usageData, err := collectUsageData()
+	config := loadConfigOrDefault()
+
+	usageData, err := collectUsageData(config)
 	if err != nil {
 		fmt.Printf("Error collecting data: %v\n", err)
 		os.Exit(1)
@@ -195,13 +419,32 @@ func handleTest() {
 	fmt.Printf("\nOutput saved to: %s\n", outputFile)
 	fmt.Printf("Total days: %d\n", len(usageData.Daily))
 
+	fmt.Println("Collection:")
+	printDiagnostics(&usageData.diagnostics, "  ")
+
 	// Print summary
 	var totalTokens int64
 	var totalRequests int
+	var totalCost float64
+	modelCosts := make(map[string]float64)
 	for _, day := range usageData.Daily {
 		totalTokens += day.TotalTokens
 		totalRequests += day.RequestCount
+		totalCost += day.EstimatedCostUSD
+		for _, model := range day.Models {
+			modelCosts[model.Model] += model.EstimatedCostUSD
+		}
 	}
 	fmt.Printf("Total tokens: %d\n", totalTokens)
 	fmt.Printf("Total requests: %d\n", totalRequests)
+	fmt.Printf("Estimated cost: $%.2f\n", totalCost)
+
+	models := make([]string, 0, len(modelCosts))
+	for model := range modelCosts {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		fmt.Printf("  %s: $%.2f\n", model, modelCosts[model])
+	}
 }
@@ -6,15 +6,67 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	Email          string `json:"email"`
-	ServerURL      string `json:"serverUrl"`
+	Email           string `json:"email"`
+	ServerURL       string `json:"serverUrl"`
 	IntervalSeconds int    `json:"intervalSeconds"`
+
+	// Upload a salted hash instead of the project path
+	HashProjectPaths bool   `json:"hashProjectPaths,omitempty"`
+	ProjectHashSalt  string `json:"projectHashSalt,omitempty"`
+
+	// JSON file overriding entries of the built-in pricing table
+	PricingFile string `json:"pricingFile,omitempty"`
+
+	// Limits for payloads kept in the spool after failed uploads
+	SpoolMaxFiles int   `json:"spoolMaxFiles,omitempty"`
+	SpoolMaxBytes int64 `json:"spoolMaxBytes,omitempty"`
+
+	// Sent as a bearer token; CLAUDE_MONITOR_API_TOKEN takes precedence
+	APIToken string `json:"apiToken,omitempty"`
+
+	// Enables HMAC-SHA256 request signing; CLAUDE_MONITOR_SIGNING_SECRET takes precedence
+	SigningSecret string `json:"signingSecret,omitempty"`
+
+	// TLS: extra CA bundle to trust and an optional client certificate for mTLS
+	CACertFile     string `json:"caCertFile,omitempty"`
+	ClientCertFile string `json:"clientCertFile,omitempty"`
+	ClientKeyFile  string `json:"clientKeyFile,omitempty"`
+
+	// Explicit proxies; when both are empty the *_PROXY environment variables apply
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
+
+	// Destinations for usage data; when empty, only serverUrl is used
+	Sinks []SinkConfig `json:"sinks,omitempty"`
+
+	// Address for the Prometheus /metrics listener, e.g. "127.0.0.1:9464"; disabled when empty
+	MetricsAddr string `json:"metricsAddr,omitempty"`
+
+	// IANA zone (e.g. "Asia/Seoul") that usage is cut into days in; defaults to the local zone
+	Timezone string `json:"timezone,omitempty"`
+
+	// Number of days, including today, that are collected and uploaded
+	LookbackDays int `json:"lookbackDays,omitempty"`
+
+	// "full" uploads every day each interval; "changed" uploads only days
+	// whose totals changed since the last successful upload, plus a full
+	// resync every fullResyncHours
+	UploadMode      string `json:"uploadMode,omitempty"`
+	FullResyncHours int    `json:"fullResyncHours,omitempty"`
 }
 
+const (
+	defaultLookbackDays    = 90
+	defaultFullResyncHours = 24
+)
+
 func getConfigDir() string {
 	homeDir, _ := os.UserHomeDir()
 	return filepath.Join(homeDir, ".claude-monitor")
@@ -78,11 +130,59 @@ func saveConfig(config *Config) error {
 	return os.WriteFile(getConfigPath(), data, 0600)
 }
 
+// getAPIToken returns the token to authenticate uploads with, if any
+func (c *Config) getAPIToken() string {
+	if token := os.Getenv("CLAUDE_MONITOR_API_TOKEN"); token != "" {
+		return token
+	}
+	return c.APIToken
+}
+
+// getLookbackDays returns the collection window in days
+func (c *Config) getLookbackDays() int {
+	if c.LookbackDays <= 0 {
+		return defaultLookbackDays
+	}
+	return c.LookbackDays
+}
+
+// getWindowStart returns midnight in loc of the first day in the collection window
+func (c *Config) getWindowStart(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day()-(c.getLookbackDays()-1), 0, 0, 0, 0, loc)
+}
+
+// getFullResyncInterval returns how often "changed" mode uploads every day
+func (c *Config) getFullResyncInterval() time.Duration {
+	if c.FullResyncHours <= 0 {
+		return defaultFullResyncHours * time.Hour
+	}
+	return time.Duration(c.FullResyncHours) * time.Hour
+}
+
+// getSigningSecret returns the HMAC key for request signing, if any
+func (c *Config) getSigningSecret() string {
+	if secret := os.Getenv("CLAUDE_MONITOR_SIGNING_SECRET"); secret != "" {
+		return secret
+	}
+	return c.SigningSecret
+}
+
 func parseInstallArgs(args []string) *Config {
 	config := &Config{
 		ServerURL:       "http://10.12.200.99:3498",
 		IntervalSeconds: 600,
 	}
+	applyInstallArgs(config, args)
+
+	return config
+}
+
+// applyInstallArgs overrides config fields with the given CLI flags and
+// reports whether any were present
+func applyInstallArgs(config *Config, args []string) bool {
+	before := *config
+	before.Sinks = append([]SinkConfig(nil), config.Sinks...)
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -105,10 +205,91 @@ func parseInstallArgs(args []string) *Config {
 				}
 				i++
 			}
+		case "--pricing":
+			if i+1 < len(args) {
+				config.PricingFile = args[i+1]
+				i++
+			}
+		case "--hash-projects":
+			config.HashProjectPaths = true
+		case "--project-salt":
+			if i+1 < len(args) {
+				config.ProjectHashSalt = args[i+1]
+				i++
+			}
+		case "--token":
+			if i+1 < len(args) {
+				config.APIToken = args[i+1]
+				i++
+			}
+		case "--ca-cert":
+			if i+1 < len(args) {
+				config.CACertFile = args[i+1]
+				i++
+			}
+		case "--client-cert":
+			if i+1 < len(args) {
+				config.ClientCertFile = args[i+1]
+				i++
+			}
+		case "--client-key":
+			if i+1 < len(args) {
+				config.ClientKeyFile = args[i+1]
+				i++
+			}
+		case "--proxy":
+			if i+1 < len(args) {
+				config.HTTPProxy = args[i+1]
+				config.HTTPSProxy = args[i+1]
+				i++
+			}
+		case "--no-proxy":
+			if i+1 < len(args) {
+				config.NoProxy = args[i+1]
+				i++
+			}
+		case "--metrics-addr":
+			if i+1 < len(args) {
+				config.MetricsAddr = args[i+1]
+				i++
+			}
+		case "--timezone":
+			if i+1 < len(args) {
+				config.Timezone = args[i+1]
+				i++
+			}
+		case "--lookback-days":
+			if i+1 < len(args) {
+				var days int
+				fmt.Sscanf(args[i+1], "%d", &days)
+				if days > 0 {
+					config.LookbackDays = days
+				}
+				i++
+			}
+		case "--upload-mode":
+			if i+1 < len(args) {
+				config.UploadMode = args[i+1]
+				i++
+			}
+		case "--resync-hours":
+			if i+1 < len(args) {
+				var hours int
+				fmt.Sscanf(args[i+1], "%d", &hours)
+				if hours > 0 {
+					config.FullResyncHours = hours
+				}
+				i++
+			}
+		case "--signing-secret":
+			if i+1 < len(args) {
+				config.SigningSecret = args[i+1]
+				i++
+			}
 		}
 	}
 
-	return config
+	return !reflect.DeepEqual(*config, before)
 }
 
 // promptInput prompts user for input with optional default value
@@ -163,11 +344,31 @@ func promptConfig() *Config {
 	return config
 }
 
-// getOrCreateConfig loads existing config or prompts user to create one
+// getOrCreateConfig loads existing config or prompts user to create one.
+// Flags given to install are saved to the file.
 func getOrCreateConfig(args []string) (*Config, error) {
 	// Try to load existing config first
 	existingConfig, err := loadConfig()
 	if err == nil {
+		// Flags given on the command line update the existing config
+		updated := applyInstallArgs(existingConfig, args)
+
+		// Project hashing may have been enabled by editing the file directly
+		if existingConfig.HashProjectPaths && existingConfig.ProjectHashSalt == "" {
+			existingConfig.ProjectHashSalt = generateProjectSalt()
+			updated = true
+		}
+
+		if updated {
+			if err := validateConfig(existingConfig); err != nil {
+				return nil, err
+			}
+			if err := saveConfig(existingConfig); err != nil {
+				return nil, fmt.Errorf("failed to save config: %w", err)
+			}
+			fmt.Printf("Configuration updated in %s\n", getConfigPath())
+			fmt.Println()
+		}
 		return existingConfig, nil
 	}
 
@@ -177,6 +378,15 @@ func getOrCreateConfig(args []string) (*Config, error) {
 	// If email not provided via args, prompt interactively
 	if config.Email == "" {
 		config = promptConfig()
+		applyInstallArgs(config, args)
+	}
+
+	if config.HashProjectPaths && config.ProjectHashSalt == "" {
+		config.ProjectHashSalt = generateProjectSalt()
+	}
+
+	if err := validateConfig(config); err != nil {
+		return nil, err
 	}
 
 	// Save the new config
@@ -189,3 +399,80 @@ func getOrCreateConfig(args []string) (*Config, error) {
 
 	return config, nil
 }
+
+// loadConfigOrDefault returns the saved config, or an empty one for the
+// commands that don't need one; those then use the built-in pricing
+func loadConfigOrDefault() *Config {
+	config, err := loadConfig()
+	if err != nil {
+		return &Config{}
+	}
+	return config
+}
+
+// loadRunConfig loads the config for run. Its flags override the file for
+// this process only, so a one-off run --server ... leaves the service's
+// config alone. Without a config file, one is created as by install.
+func loadRunConfig(args []string) (*Config, error) {
+	if _, err := os.Stat(getConfigPath()); os.IsNotExist(err) {
+		return getOrCreateConfig(args)
+	}
+
+	config, err := loadReloadedConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRunArgs(config, args, ""); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyRunArgs applies the flags given to run on top of the config file,
+// without saving them. If they turn on project hashing and the file has no
+// salt, salt is used, or a new one when empty.
+func applyRunArgs(config *Config, args []string, salt string) error {
+	if !applyInstallArgs(config, args) {
+		return nil
+	}
+	if config.HashProjectPaths && config.ProjectHashSalt == "" {
+		config.ProjectHashSalt = salt
+		if salt == "" {
+			config.ProjectHashSalt = generateProjectSalt()
+		}
+	}
+	return validateConfig(config)
+}
+
+// validateConfig checks the files and URLs the config refers to
+func validateConfig(config *Config) error {
+	if _, err := loadPricing(config.PricingFile); err != nil {
+		return err
+	}
+	if _, err := config.getLocation(); err != nil {
+		return err
+	}
+	if config.LookbackDays < 0 {
+		return fmt.Errorf("lookbackDays must not be negative")
+	}
+	if config.UploadMode != "" && config.UploadMode != "full" && config.UploadMode != "changed" {
+		return fmt.Errorf("uploadMode must be \"full\" or \"changed\", got %q", config.UploadMode)
+	}
+	if config.FullResyncHours < 0 {
+		return fmt.Errorf("fullResyncHours must not be negative")
+	}
+	if err := validateTransportConfig(config); err != nil {
+		return err
+	}
+
+	sinkConfigs, err := getSinkConfigs(config)
+	if err != nil {
+		return err
+	}
+	for _, sinkConfig := range sinkConfigs {
+		if _, err := newSink(config, sinkConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
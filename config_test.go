@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestRunArgsNotSaved checks that flags given to run override the config
+// for that process only, while install saves them
+func TestRunArgsNotSaved(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	saved := &Config{Email: "dev@example.com", ServerURL: "http://usage.example.com", IntervalSeconds: 600}
+	if err := saveConfig(saved); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(getConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"--server", "http://127.0.0.1:9999", "--hash-projects"}
+	config, err := loadRunConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerURL != "http://127.0.0.1:9999" || !config.HashProjectPaths || config.ProjectHashSalt == "" {
+		t.Errorf("run config = %+v, want the flags applied with a salt", config)
+	}
+	if after, _ := os.ReadFile(getConfigPath()); string(after) != string(before) {
+		t.Errorf("run rewrote the config file:\n%s", after)
+	}
+
+	// A reload keeps the flags and the salt made up for them
+	reloaded, err := loadReloadedConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyRunArgs(reloaded, args, config.ProjectHashSalt); err != nil {
+		t.Fatal(err)
+	}
+	if diff := configDiff(config, reloaded); len(diff) != 0 {
+		t.Errorf("reload changed %v", diff)
+	}
+
+	if _, err := getOrCreateConfig(args); err != nil {
+		t.Fatal(err)
+	}
+	installed, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed.ServerURL != "http://127.0.0.1:9999" || !installed.HashProjectPaths {
+		t.Errorf("installed config = %+v, want the flags saved", installed)
+	}
+}
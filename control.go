@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Bounds a status query, so a hung daemon can't hang status
+	controlTimeout = 5 * time.Second
+
+	// Bounds waiting for an on-demand upload, which retries with backoff
+	syncTimeout = 10 * time.Minute
+
+	// Carries the token of endpoints that other users could connect to
+	controlTokenHeader = "X-Control-Token"
+)
+
+// DaemonStatus is what the running daemon reports over the control socket
+type DaemonStatus struct {
+	PID       int         `json:"pid"`
+	Version   string      `json:"version"`
+	StartTime time.Time   `json:"startTime"`
+	Sinks     []SinkState `json:"sinks"`
+
+	// Absent until the first collection finished
+	LastCollection *CollectionStatus `json:"lastCollection,omitempty"`
+}
+
+// CollectionStatus describes the most recent collection run
+type CollectionStatus struct {
+	Time        time.Time   `json:"time"`
+	Count       int         `json:"count"`
+	Days        int         `json:"days"`
+	Diagnostics Diagnostics `json:"diagnostics"`
+
+	// Estimated cost by date, so status needn't collect again
+	DailyCostUSD map[string]float64 `json:"dailyCostUSD,omitempty"`
+}
+
+func getControlPath() string {
+	return filepath.Join(getConfigDir(), controlFileName)
+}
+
+// startControlServer serves status queries and upload requests from other
+// claude-monitor commands on a local endpoint that only this user can reach.
+// syncNow uploads to every sink and returns the results.
+func startControlServer(state *DaemonState, syncNow func() []SyncResult, logger *log.Logger) (*http.Server, error) {
+	listener, token, err := listenControl()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state.status())
+	})
+	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		logger.Printf("Upload requested via control socket")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(syncNow())
+	})
+
+	server := &http.Server{Handler: requireControlToken(mux, token), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Printf("Control server error: %v", err)
+		}
+		cleanupControl()
+	}()
+
+	return server, nil
+}
+
+// requireControlToken rejects requests without the token; an empty token
+// lets every request through
+func requireControlToken(handler http.Handler, token string) http.Handler {
+	if token == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(controlTokenHeader)), []byte(token)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// newControlClient returns a client whose requests go to the control endpoint,
+// whatever host the URL names
+func newControlClient(timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialControl(ctx)
+		},
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// controlRequest returns a request to the daemon, carrying the token if the
+// endpoint needs one
+func controlRequest(method string, path string) (*http.Request, error) {
+	token, err := controlToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, "http://claude-monitor"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set(controlTokenHeader, token)
+	}
+	return req, nil
+}
+
+// queryDaemonStatus asks the running daemon for its status; an error means
+// no daemon answered
+func queryDaemonStatus() (*DaemonStatus, error) {
+	req, err := controlRequest(http.MethodGet, "/status")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := newControlClient(controlTimeout).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control socket: HTTP %d", resp.StatusCode)
+	}
+
+	var status DaemonStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// requestSync asks the running daemon to upload to every sink now and waits
+// for the results
+func requestSync() ([]SyncResult, error) {
+	req, err := controlRequest(http.MethodPost, "/sync")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := newControlClient(syncTimeout).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control socket: HTTP %d", resp.StatusCode)
+	}
+
+	var results []SyncResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// printDaemonStatus shows what the running daemon reported
+func printDaemonStatus(status *DaemonStatus) {
+	now := time.Now()
+
+	fmt.Printf("\nDaemon:\n")
+	fmt.Printf("  PID: %d (v%s)\n", status.PID, status.Version)
+	fmt.Printf("  Uptime: %s (since %s)\n", now.Sub(status.StartTime).Round(time.Second), status.StartTime.Local().Format("2006-01-02 15:04:05"))
+
+	for _, sink := range status.Sinks {
+		fmt.Printf("\n  Sink %s:\n", sink.Name)
+		fmt.Printf("    Uploads: %d (%d failed)\n", sink.Uploads, sink.Failures)
+		if !sink.LastSuccess.IsZero() {
+			fmt.Printf("    Last success: %s (%s ago) - %s\n", sink.LastSuccess.Local().Format("2006-01-02 15:04:05"),
+				now.Sub(sink.LastSuccess).Round(time.Second), sink.LastMessage)
+		}
+		if !sink.LastFailure.IsZero() {
+			fmt.Printf("    Last failure: %s (%s ago) - %s\n", sink.LastFailure.Local().Format("2006-01-02 15:04:05"),
+				now.Sub(sink.LastFailure).Round(time.Second), sink.LastError)
+		}
+		if !sink.NextRun.IsZero() {
+			fmt.Printf("    Next run: %s (in %s)\n", sink.NextRun.Local().Format("15:04:05"), sink.NextRun.Sub(now).Round(time.Second))
+		}
+	}
+
+	if collection := status.LastCollection; collection != nil {
+		fmt.Printf("\n  Last collection: %s (%s ago, %d runs, %d days of data)\n", collection.Time.Local().Format("2006-01-02 15:04:05"),
+			now.Sub(collection.Time).Round(time.Second), collection.Count, collection.Days)
+		printDiagnostics(&collection.Diagnostics, "    ")
+	}
+}
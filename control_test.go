@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRequireControlToken checks that a token-protected endpoint only
+// answers requests carrying the token
+func TestRequireControlToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"no token needed", "", "", http.StatusOK},
+		{"missing", "secret", "", http.StatusForbidden},
+		{"wrong", "secret", "guess", http.StatusForbidden},
+		{"prefix", "secret", "secre", http.StatusForbidden},
+		{"correct", "secret", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/sync", nil)
+			if tt.header != "" {
+				req.Header.Set(controlTokenHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			requireControlToken(ok, tt.token).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// TestDaemonStatusCosts checks that the status carries the cost of each day
+// of the last collection, which status shows instead of collecting again
+func TestDaemonStatusCosts(t *testing.T) {
+	state := newDaemonState()
+	state.recordCollection(&UsageData{Daily: []DailyStats{
+		{Date: "2025-01-01", TokenTotals: TokenTotals{EstimatedCostUSD: 1.5}},
+		{Date: "2025-01-02", TokenTotals: TokenTotals{EstimatedCostUSD: 0.25}},
+	}}, time.Second)
+
+	data, err := json.Marshal(state.status())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status DaemonStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]float64{"2025-01-01": 1.5, "2025-01-02": 0.25}
+	if status.LastCollection == nil || !reflect.DeepEqual(status.LastCollection.DailyCostUSD, want) {
+		t.Errorf("last collection = %+v, want daily costs %v", status.LastCollection, want)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+)
+
+// The control endpoint is a Unix socket in the config directory
+const controlFileName = "control.sock"
+
+// listenControl returns no token: the socket's permissions already keep
+// other users out
+func listenControl() (net.Listener, string, error) {
+	path := getControlPath()
+	if err := os.MkdirAll(getConfigDir(), 0700); err != nil {
+		return nil, "", err
+	}
+
+	// A socket left behind by a daemon that crashed blocks the listen, but
+	// one that still answers belongs to another running instance
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("another instance is listening on %s", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, "", err
+	}
+	return listener, "", nil
+}
+
+func dialControl(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", getControlPath())
+}
+
+// controlToken is empty, see listenControl
+func controlToken() (string, error) {
+	return "", nil
+}
+
+// cleanupControl has nothing to do; closing the listener removes the socket
+func cleanupControl() {}
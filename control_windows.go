@@ -0,0 +1,76 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// Named pipes need more than the standard library offers, so the control
+// endpoint is a loopback port. Any local user can connect to it, so the
+// address file in the config directory, which only this user can read
+// (profile directories are private by default), also holds a random token
+// that every request must carry.
+const controlFileName = "control.addr"
+
+func listenControl() (net.Listener, string, error) {
+	if err := os.MkdirAll(getConfigDir(), 0700); err != nil {
+		return nil, "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(secret)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	content := listener.Addr().String() + "\n" + token + "\n"
+	if err := os.WriteFile(getControlPath(), []byte(content), 0600); err != nil {
+		listener.Close()
+		return nil, "", err
+	}
+	return listener, token, nil
+}
+
+// readControlFile returns the address and token the daemon wrote
+func readControlFile() (string, string, error) {
+	data, err := os.ReadFile(getControlPath())
+	if err != nil {
+		return "", "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return "", "", errors.New("invalid control address file, is the daemon an older version?")
+	}
+	return fields[0], fields[1], nil
+}
+
+func dialControl(ctx context.Context) (net.Conn, error) {
+	addr, _, err := readControlFile()
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// controlToken returns the token requests to the daemon must carry
+func controlToken() (string, error) {
+	_, token, err := readControlFile()
+	return token, err
+}
+
+// cleanupControl removes the address file once the daemon stops listening
+func cleanupControl() {
+	os.Remove(getControlPath())
+}
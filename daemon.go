@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncResult is the outcome of an on-demand upload to one sink
+type SyncResult struct {
+	Sink    string `json:"sink"`
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// syncRequest asks a sink to upload now; the result is sent on the channel
+type syncRequest chan<- SyncResult
+
+// runSink uploads to one sink on its own schedule, and whenever asked on
+// trigger, until stop is closed, then makes a final upload. Closing quit
+// ends it without the final upload, for a config reload.
+func runSink(config *Config, sink Sink, interval time.Duration, logger *log.Logger, state *DaemonState, trigger <-chan syncRequest, quit <-chan struct{}, stop <-chan struct{}) {
+	prefix := fmt.Sprintf("[%s] ", sink.Name())
+	state.addSink(sink.Name())
+
+	// Uploads stop waiting to retry once the loop is told to end, so a stop
+	// or reload isn't held up by a server that is down
+	cancel := make(chan struct{})
+	go func() {
+		select {
+		case <-quit:
+		case <-stop:
+		}
+		close(cancel)
+	}()
+
+	// Initial upload
+	logger.Printf("%sPerforming initial upload...", prefix)
+	result, err := uploadToSink(config, sink, state, cancel)
+	if err != nil {
+		logger.Printf("%sInitial upload error: %s", prefix, failureMessage(err, result))
+	} else {
+		logger.Printf("%sInitial upload: %s", prefix, result.Message)
+	}
+
+	// Start periodic upload loop
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	state.recordNextRun(sink.Name(), time.Now().Add(interval))
+
+	uploadCount := 1
+
+	for {
+		select {
+		case tick := <-ticker.C:
+			state.recordNextRun(sink.Name(), tick.Add(interval))
+			uploadCount++
+			logger.Printf("%sUpload #%d starting...", prefix, uploadCount)
+			result, err := uploadToSink(config, sink, state, cancel)
+			if err != nil {
+				logger.Printf("%sUpload #%d error: %s", prefix, uploadCount, failureMessage(err, result))
+			} else {
+				logger.Printf("%sUpload #%d: %s", prefix, uploadCount, result.Message)
+			}
+
+		case reply := <-trigger:
+			uploadCount++
+			logger.Printf("%sUpload #%d (on demand) starting...", prefix, uploadCount)
+			result, err := uploadToSink(config, sink, state, cancel)
+			syncResult := SyncResult{Sink: sink.Name(), Success: err == nil}
+			if err != nil {
+				syncResult.Message = failureMessage(err, result)
+				logger.Printf("%sUpload #%d error: %s", prefix, uploadCount, syncResult.Message)
+			} else {
+				syncResult.Message = result.Message
+				logger.Printf("%sUpload #%d: %s", prefix, uploadCount, result.Message)
+			}
+			reply <- syncResult
+
+		case <-quit:
+			state.recordNextRun(sink.Name(), time.Time{})
+			logger.Printf("%sStopped for config reload (total uploads: %d)", prefix, uploadCount)
+			return
+
+		case <-stop:
+			logger.Printf("%sPerforming final upload...", prefix)
+			result, err := uploadToSink(config, sink, state, cancel)
+			if err != nil {
+				logger.Printf("%sFinal upload error: %s", prefix, failureMessage(err, result))
+			} else {
+				logger.Printf("%sFinal upload: %s", prefix, result.Message)
+			}
+			logger.Printf("%sStopped (total uploads: %d)", prefix, uploadCount)
+			return
+		}
+	}
+}
+
+// sinkRunner is the loop of one running sink
+type sinkRunner struct {
+	trigger chan syncRequest
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// sinkSet runs the configured sinks and replaces them all at once when the
+// config is reloaded
+type sinkSet struct {
+	logger *log.Logger
+	state  *DaemonState
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	// Guards runners, and stopped so no loop starts once shutdown began
+	mu      sync.Mutex
+	runners []*sinkRunner
+	stopped bool
+}
+
+func newSinkSet(logger *log.Logger, state *DaemonState) *sinkSet {
+	return &sinkSet{logger: logger, state: state, stop: make(chan struct{})}
+}
+
+// start runs one loop per sink with the given config, unless the set is
+// shutting down
+func (s *sinkSet) start(config *Config, sinkConfigs []SinkConfig, sinks []Sink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		s.logger.Printf("Shutting down, reloaded sinks not started")
+		return
+	}
+
+	runners := make([]*sinkRunner, len(sinks))
+	for i, sink := range sinks {
+		runner := &sinkRunner{
+			trigger: make(chan syncRequest),
+			quit:    make(chan struct{}),
+			done:    make(chan struct{}),
+		}
+		runners[i] = runner
+
+		s.wg.Add(1)
+		go func(sink Sink, interval time.Duration) {
+			defer s.wg.Done()
+			defer close(runner.done)
+			runSink(config, sink, interval, s.logger, s.state, runner.trigger, runner.quit, s.stop)
+		}(sink, time.Duration(sinkConfigs[i].IntervalSeconds)*time.Second)
+	}
+	s.runners = runners
+}
+
+// restart stops the running loops, letting uploads in progress finish, and
+// starts new ones with the given config. The old and new sinks never upload
+// at the same time.
+func (s *sinkSet) restart(config *Config, sinkConfigs []SinkConfig, sinks []Sink) {
+	s.mu.Lock()
+	old := s.runners
+	s.mu.Unlock()
+
+	for _, runner := range old {
+		close(runner.quit)
+	}
+	for _, runner := range old {
+		<-runner.done
+	}
+
+	s.start(config, sinkConfigs, sinks)
+}
+
+// sync asks every sink to upload now and waits for the results, sorted by
+// sink name. A sink busy uploading handles the request when it is done;
+// one that stops first is left out.
+func (s *sinkSet) sync() []SyncResult {
+	s.mu.Lock()
+	runners := s.runners
+	s.mu.Unlock()
+
+	results := make(chan SyncResult, len(runners))
+	sent := 0
+	for _, runner := range runners {
+		select {
+		case runner.trigger <- results:
+			sent++
+		case <-runner.done:
+		}
+	}
+
+	collected := make([]SyncResult, 0, sent)
+	for i := 0; i < sent; i++ {
+		collected = append(collected, <-results)
+	}
+	sort.Slice(collected, func(i, j int) bool {
+		return collected[i].Sink < collected[j].Sink
+	})
+	return collected
+}
+
+// shutdown stops every loop, each after a final upload, and waits until
+// they have returned. A reload still waiting for the old loops then starts
+// no new ones: the upload they were busy with was the last.
+func (s *sinkSet) shutdown() {
+	s.mu.Lock()
+	s.stopped = true
+	close(s.stop)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// newSinks creates the sinks configured in config
+func newSinks(config *Config) ([]SinkConfig, []Sink, error) {
+	sinkConfigs, err := getSinkConfigs(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sinks := make([]Sink, len(sinkConfigs))
+	for i, sinkConfig := range sinkConfigs {
+		sinks[i], err = newSink(config, sinkConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return sinkConfigs, sinks, nil
+}
+
+// uploadToSink collects fresh usage data and sends it to the sink, recording
+// the outcome in state. A panic inside a sink is turned into an error so it
+// can't take down the others.
+func uploadToSink(config *Config, sink Sink, state *DaemonState, cancel <-chan struct{}) (result *UploadResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sink panicked: %v", r)
+			result = &UploadResult{Success: false, Message: err.Error()}
+		}
+		state.recordUpload(sink.Name(), result, err)
+	}()
+
+	start := time.Now()
+	usageData, err := collectUsageData(config)
+	if err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+	state.recordCollection(usageData, time.Since(start))
+
+	return sink.Send(usageData, cancel)
+}
+
+// failureMessage combines the error and the result message without repeating either
+func failureMessage(err error, result *UploadResult) string {
+	if result == nil || result.Message == "" {
+		return err.Error()
+	}
+	if strings.Contains(result.Message, err.Error()) {
+		return result.Message
+	}
+	return fmt.Sprintf("%v - %s", err, result.Message)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Reasons a transcript line is skipped
+const (
+	skipInvalidJSON      = "invalid_json"
+	skipMissingTimestamp = "missing_timestamp"
+	skipBadTimestamp     = "bad_timestamp"
+	skipMissingUsage     = "missing_usage"
+)
+
+// Diagnostics describes what a collection read and what it couldn't use,
+// so lost usage shows up somewhere instead of being swallowed
+type Diagnostics struct {
+	// Transcripts found, and those read because they changed
+	FilesScanned int `json:"filesScanned"`
+	FilesParsed  int `json:"filesParsed"`
+
+	// Directories or files that couldn't be read, and the latest error
+	FileErrors    int    `json:"fileErrors"`
+	LastFileError string `json:"lastFileError,omitempty"`
+
+	BytesRead int64 `json:"bytesRead"`
+	Lines     int64 `json:"lines"`
+
+	// Lines over maxLineBytes, decoded by streaming
+	LongLines int64 `json:"longLines"`
+
+	// Complete lines that couldn't be used, by reason. Only assistant lines
+	// are checked for a timestamp and usage; other lines carry no usage.
+	Skipped map[string]int64 `json:"skipped,omitempty"`
+
+	// Lines repeating a message ID already read; the last one wins. Claude
+	// Code writes one line per content block, so some are expected.
+	DuplicateMessages int64 `json:"duplicateMessages"`
+
+	Duration time.Duration `json:"durationNs"`
+}
+
+func (d *Diagnostics) skip(reason string) {
+	if d.Skipped == nil {
+		d.Skipped = make(map[string]int64)
+	}
+	d.Skipped[reason]++
+}
+
+func (d *Diagnostics) fileError(path string, err error) {
+	d.FileErrors++
+	d.LastFileError = fmt.Sprintf("%s: %v", path, err)
+}
+
+// skippedLines returns the number of skipped lines over all reasons
+func (d *Diagnostics) skippedLines() int64 {
+	var total int64
+	for _, count := range d.Skipped {
+		total += count
+	}
+	return total
+}
+
+// skipReasons returns the reasons with skipped lines, sorted
+func (d *Diagnostics) skipReasons() []string {
+	reasons := make([]string, 0, len(d.Skipped))
+	for reason := range d.Skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// merge adds the counts of other; the duration is left alone since
+// merged parts run concurrently
+func (d *Diagnostics) merge(other Diagnostics) {
+	d.FilesScanned += other.FilesScanned
+	d.FilesParsed += other.FilesParsed
+	d.FileErrors += other.FileErrors
+	if other.LastFileError != "" {
+		d.LastFileError = other.LastFileError
+	}
+	d.BytesRead += other.BytesRead
+	d.Lines += other.Lines
+	d.LongLines += other.LongLines
+	for reason, count := range other.Skipped {
+		if d.Skipped == nil {
+			d.Skipped = make(map[string]int64)
+		}
+		d.Skipped[reason] += count
+	}
+	d.DuplicateMessages += other.DuplicateMessages
+}
+
+// printDiagnostics writes a short human-readable summary
+func printDiagnostics(d *Diagnostics, indent string) {
+	fmt.Printf("%sFiles: %d found, %d read", indent, d.FilesScanned, d.FilesParsed)
+	if d.FileErrors > 0 {
+		fmt.Printf(", %d unreadable", d.FileErrors)
+	}
+	fmt.Println()
+	fmt.Printf("%sLines read: %d (%s bytes, %d over 1 MB)\n", indent, d.Lines, formatCount(d.BytesRead), d.LongLines)
+	fmt.Printf("%sDuplicate message lines: %d\n", indent, d.DuplicateMessages)
+	if skipped := d.skippedLines(); skipped > 0 {
+		fmt.Printf("%sSkipped lines: %d\n", indent, skipped)
+		for _, reason := range d.skipReasons() {
+			fmt.Printf("%s  %s: %d\n", indent, reason, d.Skipped[reason])
+		}
+	}
+	if d.LastFileError != "" {
+		fmt.Printf("%sLast file error: %s\n", indent, d.LastFileError)
+	}
+	if d.Duration > 0 {
+		fmt.Printf("%sDuration: %s\n", indent, d.Duration.Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doctorTimeout bounds each reachability check
+const doctorTimeout = 10 * time.Second
+
+// doctorReport prints check results and remembers whether any failed
+type doctorReport struct {
+	failures int
+	warnings int
+}
+
+func (r *doctorReport) ok(format string, args ...interface{}) {
+	fmt.Printf("[ OK ] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(message string, fix string) {
+	r.warnings++
+	fmt.Printf("[WARN] %s\n", message)
+	if fix != "" {
+		fmt.Printf("       Fix: %s\n", fix)
+	}
+}
+
+func (r *doctorReport) fail(message string, fix string) {
+	r.failures++
+	fmt.Printf("[FAIL] %s\n", message)
+	if fix != "" {
+		fmt.Printf("       Fix: %s\n", fix)
+	}
+}
+
+// handleDoctor checks the setup end to end and suggests fixes for what is wrong
+func handleDoctor() {
+	fmt.Println("Claude Monitor Doctor")
+	fmt.Println("=====================")
+
+	report := &doctorReport{}
+
+	config := checkConfig(report)
+	checkProjectsDir(report, config)
+	if config != nil {
+		checkSinks(report, config)
+	}
+	checkService(report)
+	checkLogFile(report)
+
+	fmt.Println()
+	switch {
+	case report.failures > 0:
+		fmt.Printf("%d problems found, %d warnings\n", report.failures, report.warnings)
+		os.Exit(1)
+	case report.warnings > 0:
+		fmt.Printf("No problems found, %d warnings\n", report.warnings)
+	default:
+		fmt.Println("No problems found")
+	}
+}
+
+// checkConfig loads and validates the config; it returns nil if there is no
+// usable config
+func checkConfig(report *doctorReport) *Config {
+	configPath := getConfigPath()
+
+	config, err := loadConfig()
+	if os.IsNotExist(err) {
+		report.fail(fmt.Sprintf("Config: %s does not exist", configPath),
+			"Run 'claude-monitor install --email your@email.com'")
+		return nil
+	}
+	if err != nil {
+		report.fail(fmt.Sprintf("Config: cannot read %s: %v", configPath, err),
+			fmt.Sprintf("Correct the JSON in %s, or delete it and run 'claude-monitor install' again", configPath))
+		return nil
+	}
+
+	if err := validateConfig(config); err != nil {
+		report.fail(fmt.Sprintf("Config: %v", err),
+			fmt.Sprintf("Edit %s, or run 'claude-monitor install' with corrected options", configPath))
+		return nil
+	}
+	for _, warning := range transportWarnings(config) {
+		report.warn("Config: "+warning, "Use an https:// server URL, or remove the TLS options")
+	}
+	if config.Email == "" {
+		report.warn("Config: no email set, uploads can't be attributed",
+			"Run 'claude-monitor install --email your@email.com'")
+	} else {
+		report.ok("Config: %s", configPath)
+	}
+	return config
+}
+
+// checkProjectsDir makes sure the transcripts can be read and reports lines
+// that can't be used. The scan doesn't touch the checkpoint.
+func checkProjectsDir(report *doctorReport, config *Config) {
+	claudeDir := getClaudeProjectsDir()
+
+	info, err := os.Stat(claudeDir)
+	if os.IsNotExist(err) {
+		report.fail(fmt.Sprintf("Projects dir: %s does not exist", claudeDir),
+			"Use Claude Code at least once, or point CLAUDE_PROJECTS_DIR at its projects directory")
+		return
+	}
+	if err != nil || !info.IsDir() {
+		report.fail(fmt.Sprintf("Projects dir: %s is not a readable directory", claudeDir),
+			"Point CLAUDE_PROJECTS_DIR at the Claude Code projects directory")
+		return
+	}
+	if _, err := os.ReadDir(claudeDir); err != nil {
+		report.fail(fmt.Sprintf("Projects dir: %v", err),
+			fmt.Sprintf("Make %s readable by this user", claudeDir))
+		return
+	}
+
+	if config == nil {
+		config = &Config{}
+	}
+	loc, err := config.getLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	watcher := newUsageWatcher(config.getWindowStart(loc))
+	start := time.Now()
+	watcher.scan()
+	diagnostics := &watcher.diagnostics
+	diagnostics.Duration = time.Since(start)
+
+	if diagnostics.FilesScanned == 0 {
+		report.warn(fmt.Sprintf("Projects dir: no transcripts in %s", claudeDir),
+			"Use Claude Code, or point CLAUDE_PROJECTS_DIR at the right directory")
+	} else {
+		report.ok("Projects dir: %s (%d transcripts, %d messages in the collection window)",
+			claudeDir, diagnostics.FilesScanned, len(watcher.messages))
+	}
+
+	if diagnostics.FileErrors > 0 {
+		report.warn(fmt.Sprintf("Transcripts: %d files or directories could not be read (%s)", diagnostics.FileErrors, diagnostics.LastFileError),
+			"Check the permissions of the files below "+claudeDir)
+	}
+	if skipped := diagnostics.skippedLines(); skipped > 0 {
+		reasons := make([]string, 0, len(diagnostics.Skipped))
+		for _, reason := range diagnostics.skipReasons() {
+			reasons = append(reasons, fmt.Sprintf("%s: %d", reason, diagnostics.Skipped[reason]))
+		}
+		report.warn(fmt.Sprintf("Transcripts: %d of %d lines skipped (%s)", skipped, diagnostics.Lines, strings.Join(reasons, ", ")),
+			"Usage on these lines is not counted; update claude-monitor if Claude Code changed its transcript format")
+	}
+
+	fmt.Println()
+	printDiagnostics(diagnostics, "       ")
+	fmt.Println()
+}
+
+// checkSinks checks that every sink's destination can be reached
+func checkSinks(report *doctorReport, config *Config) {
+	sinkConfigs, err := getSinkConfigs(config)
+	if err != nil {
+		report.fail(fmt.Sprintf("Sinks: %v", err), "Fix the sinks section of "+getConfigPath())
+		return
+	}
+
+	for _, sinkConfig := range sinkConfigs {
+		sink, err := newSink(config, sinkConfig)
+		if err != nil {
+			report.fail(fmt.Sprintf("Sink %s: %v", sinkConfig.Name, err), "Fix the sink in "+getConfigPath())
+			continue
+		}
+
+		switch s := sink.(type) {
+		case *HTTPSink:
+			checkReachable(report, s.name, s.client, s.serverURL)
+		case *OTLPSink:
+			checkReachable(report, s.name, s.client, s.endpoint)
+		case *FileSink:
+			checkWritable(report, "Sink "+s.name, filepath.Dir(s.path))
+		}
+	}
+}
+
+// checkReachable makes a plain GET to rawURL through the upload client, so
+// TLS and proxy settings apply. Any HTTP response means the server is up.
+func checkReachable(report *doctorReport, name string, client *http.Client, rawURL string) {
+	probe := *client
+	probe.Timeout = doctorTimeout
+
+	resp, err := probe.Get(rawURL)
+	if err != nil {
+		report.fail(fmt.Sprintf("Sink %s: %s is unreachable: %v", name, rawURL, err),
+			"Check the server URL, your network or VPN, and the proxy and TLS settings")
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		report.warn(fmt.Sprintf("Sink %s: %s answered HTTP %d", name, rawURL, resp.StatusCode),
+			"Check apiToken (or CLAUDE_MONITOR_API_TOKEN) and signingSecret")
+		return
+	}
+	if resp.StatusCode >= 500 {
+		report.warn(fmt.Sprintf("Sink %s: %s answered HTTP %d", name, rawURL, resp.StatusCode),
+			"The server is up but failing; uploads are spooled and retried")
+		return
+	}
+	report.ok("Sink %s: %s is reachable (HTTP %d)", name, rawURL, resp.StatusCode)
+}
+
+// checkService reports whether the background service is registered and running
+func checkService(report *doctorReport) {
+	if !isServiceInstalled() {
+		report.warn("Service: not installed, usage is only uploaded while 'claude-monitor run' is running",
+			"Run 'claude-monitor install' to start it at login")
+		return
+	}
+
+	status := getServiceStatus()
+	if !strings.HasPrefix(status, "Running") {
+		report.warn("Service: "+status,
+			fmt.Sprintf("Check %s for errors, or run 'claude-monitor run' in a terminal to see them", getLogPath()))
+		return
+	}
+	report.ok("Service: %s", status)
+}
+
+// checkLogFile makes sure the log and state files can be written
+func checkLogFile(report *doctorReport) {
+	logPath := getLogPath()
+	os.MkdirAll(getConfigDir(), 0700)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		report.fail(fmt.Sprintf("Log file: %v", err),
+			fmt.Sprintf("Create %s or make it writable by this user", getConfigDir()))
+		return
+	}
+	logFile.Close()
+	report.ok("Log file: %s", logPath)
+
+	checkWritable(report, "State dir", getConfigDir())
+}
+
+// checkWritable creates and removes a temporary file in dir, creating dir
+// first like the daemon would
+func checkWritable(report *doctorReport, name string, dir string) {
+	err := os.MkdirAll(dir, 0700)
+	var tmp *os.File
+	if err == nil {
+		tmp, err = os.CreateTemp(dir, ".doctor-*")
+	}
+	if err != nil {
+		report.fail(fmt.Sprintf("%s: %s is not writable: %v", name, dir, err),
+			fmt.Sprintf("Create %s or make it writable by this user", dir))
+		return
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	report.ok("%s: %s is writable", name, dir)
+}
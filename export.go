@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportOptions holds the flags of the export command
+type ExportOptions struct {
+	Format      string
+	Granularity string
+	Output      string
+}
+
+// ExportRecord is one exported row: a single message, or the messages of one
+// hour or day sharing model, project and session
+type ExportRecord struct {
+	// Message time, or the start of the hour or day, in the configured timezone
+	Timestamp string `json:"timestamp"`
+	time      time.Time
+
+	// Only set for message granularity, and only if the message has an ID
+	MessageID string `json:"messageId,omitempty"`
+
+	Model   string `json:"model"`
+	Project string `json:"project"`
+	Session string `json:"session"`
+
+	InputTokens      int64   `json:"inputTokens"`
+	OutputTokens     int64   `json:"outputTokens"`
+	CacheWriteTokens int64   `json:"cacheWriteTokens"`
+	CacheReadTokens  int64   `json:"cacheReadTokens"`
+	RequestCount     int     `json:"requestCount"`
+	EstimatedCostUSD float64 `json:"estimatedCostUSD"`
+}
+
+var exportFormats = []string{"csv", "ndjson", "json"}
+
+var exportGranularities = []string{"message", "hour", "day"}
+
+var exportCSVHeader = []string{"timestamp", "message_id", "model", "project", "session",
+	"input_tokens", "output_tokens", "cache_write_tokens", "cache_read_tokens",
+	"request_count", "estimated_cost_usd"}
+
+func parseExportArgs(args []string) (*ExportOptions, error) {
+	options := &ExportOptions{Format: "csv", Granularity: "message"}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			if i+1 < len(args) {
+				options.Format = args[i+1]
+				i++
+			}
+		case "--granularity":
+			if i+1 < len(args) {
+				options.Granularity = args[i+1]
+				i++
+			}
+		case "--output", "-o":
+			if i+1 < len(args) {
+				options.Output = args[i+1]
+				i++
+			}
+		default:
+			return nil, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	if !containsString(exportFormats, options.Format) {
+		return nil, fmt.Errorf("--format must be one of %s", strings.Join(exportFormats, ", "))
+	}
+	if !containsString(exportGranularities, options.Granularity) {
+		return nil, fmt.Errorf("--granularity must be one of %s", strings.Join(exportGranularities, ", "))
+	}
+
+	return options, nil
+}
+
+// handleExport writes the deduplicated per-message usage to stdout or a file
+func handleExport() {
+	options, err := parseExportArgs(os.Args[2:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	config := loadConfigOrDefault()
+
+	pricing, err := loadPricing(config.PricingFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	loc, err := config.getLocation()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	collectMu.Lock()
+	messageData, err := collectMessageData(config.getWindowStart(loc), &Diagnostics{})
+	var records []ExportRecord
+	if err == nil {
+		records = buildExportRecords(messageData, pricing, options.Granularity, loc)
+	}
+	collectMu.Unlock()
+	if err != nil {
+		fmt.Printf("Error collecting data: %v\n", err)
+		os.Exit(1)
+	}
+
+	var out io.Writer = os.Stdout
+	if options.Output != "" {
+		file, err := os.Create(options.Output)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	w := bufio.NewWriter(out)
+	err = writeExport(w, records, options.Format)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		fmt.Printf("Error writing export: %v\n", err)
+		os.Exit(1)
+	}
+
+	if options.Output != "" {
+		fmt.Printf("Exported %d records to %s\n", len(records), options.Output)
+	}
+}
+
+// buildExportRecords turns the message map into records sorted by time,
+// summing messages into hour or day buckets of loc unless granularity is "message"
+func buildExportRecords(messageData map[string]*MessageDataEntry, pricing PricingTable, granularity string, loc *time.Location) []ExportRecord {
+	projectPaths := resolveProjectPaths(messageData)
+
+	type bucketKey struct {
+		timestamp string
+		model     string
+		project   string
+		session   string
+	}
+	buckets := make(map[bucketKey]*ExportRecord)
+	records := []ExportRecord{}
+
+	for key, data := range messageData {
+		model := data.Model
+		if model == "" {
+			model = unknownModel
+		}
+
+		local := data.Timestamp.In(loc)
+		record := ExportRecord{
+			time:             local,
+			Model:            model,
+			Project:          projectPaths[data.Project],
+			Session:          data.Session,
+			InputTokens:      int64(data.Usage.InputTokens),
+			OutputTokens:     int64(data.Usage.OutputTokens),
+			CacheWriteTokens: int64(data.Usage.CacheCreationInputTokens),
+			CacheReadTokens:  int64(data.Usage.CacheReadInputTokens),
+			RequestCount:     1,
+			EstimatedCostUSD: roundCost(pricing.cost(data.Model, data.Usage)),
+		}
+
+		// Buckets are cut on local wall-clock boundaries, which also handles
+		// zones with non-hour offsets
+		switch granularity {
+		case "hour":
+			record.time = time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+			record.Timestamp = record.time.Format(time.RFC3339)
+		case "day":
+			record.time = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+			record.Timestamp = record.time.Format(time.RFC3339)
+		default:
+			record.Timestamp = local.Format(time.RFC3339Nano)
+			if !strings.HasPrefix(key, "no_id_") {
+				record.MessageID = key
+			}
+			records = append(records, record)
+			continue
+		}
+
+		bucket := bucketKey{record.Timestamp, record.Model, record.Project, record.Session}
+		if existing := buckets[bucket]; existing != nil {
+			existing.InputTokens += record.InputTokens
+			existing.OutputTokens += record.OutputTokens
+			existing.CacheWriteTokens += record.CacheWriteTokens
+			existing.CacheReadTokens += record.CacheReadTokens
+			existing.RequestCount++
+			existing.EstimatedCostUSD = roundCost(existing.EstimatedCostUSD + record.EstimatedCostUSD)
+			continue
+		}
+		buckets[bucket] = &record
+	}
+
+	for _, record := range buckets {
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.time.Equal(b.time) {
+			return a.time.Before(b.time)
+		}
+		if a.MessageID != b.MessageID {
+			return a.MessageID < b.MessageID
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		return a.Session < b.Session
+	})
+
+	return records
+}
+
+// writeExport encodes the records one at a time in the given format
+func writeExport(w io.Writer, records []ExportRecord, format string) error {
+	switch format {
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for i := range records {
+			if err := encoder.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "json":
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		for i := range records {
+			data, err := json.Marshal(&records[i])
+			if err != nil {
+				return err
+			}
+			separator := ",\n  "
+			if i == 0 {
+				separator = "\n  "
+			}
+			if _, err := io.WriteString(w, separator); err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "\n]\n")
+		return err
+
+	default:
+		csvWriter := csv.NewWriter(w)
+		csvWriter.Write(exportCSVHeader)
+		for _, record := range records {
+			csvWriter.Write([]string{
+				record.Timestamp,
+				record.MessageID,
+				record.Model,
+				record.Project,
+				record.Session,
+				strconv.FormatInt(record.InputTokens, 10),
+				strconv.FormatInt(record.OutputTokens, 10),
+				strconv.FormatInt(record.CacheWriteTokens, 10),
+				strconv.FormatInt(record.CacheReadTokens, 10),
+				strconv.Itoa(record.RequestCount),
+				strconv.FormatFloat(record.EstimatedCostUSD, 'f', 6, 64),
+			})
+		}
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Compact the history once superseded records outnumber live ones and the
+// file has grown past this many lines
+const historyCompactLines = 10000
+
+// UsageHistory is an append-only log of every message usage the monitor has
+// seen. Claude Code deletes old transcripts, so days built only from live
+// files would shrink; the history keeps them. Each line is one record and
+// later lines for the same message win, like in the transcripts.
+type UsageHistory struct {
+	path string
+
+	// Read position and identity of the file, so only appended lines are read
+	offset int64
+	inode  uint64
+	lines  int
+
+	// The file ends in a partial line (e.g. after a crash mid-write)
+	partialTail bool
+
+	messages map[string]*MessageDataEntry
+}
+
+type historyRecord struct {
+	Key string `json:"key"`
+	*MessageDataEntry
+}
+
+// usageHistory is loaded on first use and kept up to date; guarded by collectMu
+var usageHistory *UsageHistory
+
+func getHistoryPath() string {
+	return filepath.Join(getConfigDir(), "history.jsonl")
+}
+
+func newUsageHistory() *UsageHistory {
+	return &UsageHistory{
+		path:     getHistoryPath(),
+		messages: make(map[string]*MessageDataEntry),
+	}
+}
+
+// refresh reads lines appended since the last call, by this or another process
+func (h *UsageHistory) refresh() error {
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		*h = *newUsageHistory()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Replaced by a compaction elsewhere, or truncated: read it again
+	if fileInode(info) != h.inode || info.Size() < h.offset {
+		*h = *newUsageHistory()
+		h.inode = fileInode(info)
+	}
+
+	if _, err := file.Seek(h.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	h.partialTail = false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			h.partialTail = len(line) > 0
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		h.offset += int64(len(line))
+		h.lines++
+
+		var record historyRecord
+		if err := json.Unmarshal(line, &record); err != nil || record.MessageDataEntry == nil || record.Usage == nil {
+			continue
+		}
+		h.messages[record.Key] = record.MessageDataEntry
+	}
+
+	return nil
+}
+
+// update appends every live message that is new or changed since it was
+// last recorded
+func (h *UsageHistory) update(live map[string]*MessageDataEntry) error {
+	keys := make([]string, 0)
+	for key, entry := range live {
+		if !sameMessage(h.messages[key], entry) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	if h.partialTail {
+		buf.WriteByte('\n')
+	}
+	for _, key := range keys {
+		data, err := json.Marshal(historyRecord{Key: key, MessageDataEntry: live[key]})
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	// A single write keeps the lines whole if another process appends too
+	_, err = file.Write(buf.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := h.refresh(); err != nil {
+		return err
+	}
+	if h.lines > historyCompactLines && h.lines > 2*len(h.messages) {
+		return h.compact()
+	}
+	return nil
+}
+
+// compact rewrites the history with only the latest record of each message
+func (h *UsageHistory) compact() error {
+	keys := make([]string, 0, len(h.messages))
+	for key := range h.messages {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := h.messages[keys[i]], h.messages[keys[j]]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		return keys[i] < keys[j]
+	})
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		data, err := json.Marshal(historyRecord{Key: key, MessageDataEntry: h.messages[key]})
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if err := writeFileAtomic(h.path, buf.Bytes()); err != nil {
+		return err
+	}
+
+	*h = *newUsageHistory()
+	return h.refresh()
+}
+
+// since returns the recorded messages at or after windowStart
+func (h *UsageHistory) since(windowStart time.Time) map[string]*MessageDataEntry {
+	messages := make(map[string]*MessageDataEntry)
+	for key, entry := range h.messages {
+		if !entry.Timestamp.Before(windowStart) {
+			messages[key] = entry
+		}
+	}
+	return messages
+}
+
+// sameMessage reports whether two records carry the same usage. The file is
+// ignored, since resumed sessions repeat earlier messages in a new transcript.
+func sameMessage(a *MessageDataEntry, b *MessageDataEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return false
+	}
+	return a.Project == b.Project &&
+		a.Cwd == b.Cwd &&
+		a.Session == b.Session &&
+		a.Model == b.Model &&
+		reflect.DeepEqual(a.Usage, b.Usage)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// resetUsageHistory makes the next collection load the history of the
+// current config directory, and the one after the test too
+func resetUsageHistory(t *testing.T) {
+	usageHistory = nil
+	t.Cleanup(func() { usageHistory = nil })
+}
+
+// TestUsageHistory checks that updates are appended once, read back by
+// another reader, and kept through a compaction
+func TestUsageHistory(t *testing.T) {
+	setupCollection(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	entry := func(tokens int, age time.Duration) *MessageDataEntry {
+		return &MessageDataEntry{
+			Timestamp: now.Add(-age),
+			File:      "session.jsonl",
+			Project:   "-home-dev-app",
+			Model:     "claude-sonnet-4-5",
+			Usage:     &ClaudeUsage{OutputTokens: tokens},
+		}
+	}
+
+	history := newUsageHistory()
+	if err := history.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	live := map[string]*MessageDataEntry{"old": entry(1, 48*time.Hour), "new": entry(2, time.Hour)}
+	if err := history.update(live); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.update(live); err != nil {
+		t.Fatal(err)
+	}
+	if history.lines != 2 {
+		t.Errorf("history has %d lines after updating twice with the same messages, want 2", history.lines)
+	}
+
+	// A message that grew is appended again, and the later line wins
+	live["new"] = entry(5, time.Hour)
+	if err := history.update(live); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := newUsageHistory()
+	if err := reader.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	recent := reader.since(now.Add(-24 * time.Hour))
+	if len(recent) != 1 || recent["new"] == nil || recent["new"].Usage.OutputTokens != 5 {
+		t.Errorf("since a day ago: %v, want only the updated message", recent)
+	}
+	if all := reader.since(time.Time{}); len(all) != 2 {
+		t.Errorf("since the start: %d messages, want 2", len(all))
+	}
+
+	if err := reader.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if reader.lines != 2 {
+		t.Errorf("history has %d lines after compaction, want 2", reader.lines)
+	}
+	if entry := reader.since(time.Time{})["new"]; entry == nil || entry.Usage.OutputTokens != 5 {
+		t.Errorf("after compaction: new = %+v, want the latest record", entry)
+	}
+
+	// The first reader notices the file was replaced
+	if err := history.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.messages) != 2 || history.lines != 2 {
+		t.Errorf("after the compaction elsewhere: %d messages in %d lines, want 2 in 2", len(history.messages), history.lines)
+	}
+}
+
+// TestHistoryKeepsDeletedTranscripts checks that a message still counts
+// after its transcript is deleted
+func TestHistoryKeepsDeletedTranscripts(t *testing.T) {
+	project := setupCollection(t)
+	resetUsageHistory(t)
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	path := filepath.Join(project, "session.jsonl")
+	writeTranscript(t, path, []string{assistantLine("kept", timestamp, 7)})
+
+	windowStart := time.Now().Add(-24 * time.Hour)
+	if messages, err := collectMessageData(windowStart, &Diagnostics{}); err != nil || messages["kept"] == nil {
+		t.Fatalf("first collection: %v, %v", messages, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := collectMessageData(windowStart, &Diagnostics{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := messages["kept"]; entry == nil || entry.Usage.OutputTokens != 7 {
+		t.Errorf("after deleting the transcript: kept = %+v, want it from the history", entry)
+	}
+}
+
+// TestHistoryWriteError checks that a history that can't be written is
+// counted as a file error and doesn't stop the collection
+func TestHistoryWriteError(t *testing.T) {
+	project := setupCollection(t)
+	resetUsageHistory(t)
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// A directory where the file should be can't be read or appended to
+	if err := os.MkdirAll(getHistoryPath(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	writeTranscript(t, filepath.Join(project, "session.jsonl"), []string{assistantLine("live", timestamp, 1)})
+
+	var diagnostics Diagnostics
+	messages, err := collectMessageData(time.Now().Add(-24*time.Hour), &diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages["live"] == nil {
+		t.Errorf("messages = %v, want the live message", messages)
+	}
+	if diagnostics.FileErrors != 1 || diagnostics.LastFileError == "" {
+		t.Errorf("file errors = %d (%q), want the history error counted", diagnostics.FileErrors, diagnostics.LastFileError)
+	}
+}
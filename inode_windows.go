@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// fileInode returns 0 on Windows; os.FileInfo doesn't carry the file index,
+// so replaced files are detected by size and modification time only
+func fileInode(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// maxLineBytes is the longest line that is read into memory and decoded in
+// one go. Longer lines (tool results with whole files or images) are
+// streamed instead, keeping only the fields collection needs.
+const maxLineBytes = 1024 * 1024
+
+// maxFieldBytes bounds a captured field of a streamed line; usage objects and
+// IDs are tiny, so anything larger is not a field we want
+const maxFieldBytes = 64 * 1024
+
+// streamedFields are the paths kept from a streamed line, see ClaudeEntry
+var streamedFields = map[string]bool{
+	"type":          true,
+	"timestamp":     true,
+	"cwd":           true,
+	"sessionId":     true,
+	"message.id":    true,
+	"message.model": true,
+	"message.usage": true,
+}
+
+// streamedParents are objects that contain streamed fields
+var streamedParents = map[string]bool{
+	"message": true,
+}
+
+// maxKeyBytes bounds the object keys that are kept while streaming; wanted
+// keys are much shorter
+const maxKeyBytes = 256
+
+// skipPath marks values that are consumed without tracking their keys
+const skipPath = "-"
+
+var errJSONSyntax = errors.New("invalid JSON")
+
+// readLine returns the next line including its newline, or the partial last
+// line at EOF. A line longer than maxLineBytes is returned as a prefix with
+// long set; the rest of it is still unread in r.
+func readLine(r *bufio.Reader, buf []byte) ([]byte, bool, error) {
+	buf = buf[:0]
+	for {
+		chunk, err := r.ReadSlice('\n')
+		buf = append(buf, chunk...)
+		if err != bufio.ErrBufferFull {
+			return buf, false, err
+		}
+		if len(buf) >= maxLineBytes {
+			return buf, true, nil
+		}
+	}
+}
+
+// longLine reads one oversized line byte by byte: first the prefix that was
+// already read, then the rest of the line from the file
+type longLine struct {
+	prefix []byte
+	pos    int
+	r      *bufio.Reader
+
+	// Bytes read from r, and whether the line ended with a newline
+	read     int64
+	done     bool
+	complete bool
+}
+
+func (l *longLine) ReadByte() (byte, error) {
+	if l.pos < len(l.prefix) {
+		l.pos++
+		return l.prefix[l.pos-1], nil
+	}
+	if l.done {
+		return 0, io.EOF
+	}
+
+	b, err := l.r.ReadByte()
+	if err != nil {
+		l.done = true
+		return 0, io.EOF
+	}
+	l.read++
+	if b == '\n' {
+		l.done = true
+		l.complete = true
+	}
+	return b, nil
+}
+
+// drain consumes what is left of the line
+func (l *longLine) drain() {
+	for !l.done {
+		l.ReadByte()
+	}
+}
+
+// size returns the length of the line including its newline
+func (l *longLine) size() int64 {
+	return int64(len(l.prefix)) + l.read
+}
+
+// decodeLongLine decodes the streamed fields of an oversized line without
+// holding the rest of it in memory
+func decodeLongLine(l *longLine, entry *ClaudeEntry) error {
+	defer l.drain()
+
+	s := &jsonStreamer{r: l, fields: make(map[string][]byte)}
+	c, err := s.nextNonSpace()
+	if err != nil {
+		return err
+	}
+	if c != '{' {
+		return errJSONSyntax
+	}
+	if err := s.object(""); err != nil {
+		return err
+	}
+
+	targets := map[string]interface{}{
+		"type":          &entry.Type,
+		"timestamp":     &entry.Timestamp,
+		"cwd":           &entry.Cwd,
+		"sessionId":     &entry.SessionID,
+		"message.id":    &entry.Message.ID,
+		"message.model": &entry.Message.Model,
+		"message.usage": &entry.Message.Usage,
+	}
+	for path, raw := range s.fields {
+		if raw == nil {
+			return errJSONSyntax
+		}
+		if err := json.Unmarshal(raw, targets[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonStreamer is a minimal JSON scanner that walks a value byte by byte,
+// copying out the fields in streamedFields and discarding everything else
+type jsonStreamer struct {
+	r      io.ByteReader
+	fields map[string][]byte
+
+	capturing bool
+	capture   []byte
+	overflow  bool
+}
+
+func (s *jsonStreamer) next() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if s.capturing && !s.overflow {
+		if len(s.capture) >= maxFieldBytes {
+			s.overflow = true
+		} else {
+			s.capture = append(s.capture, b)
+		}
+	}
+	return b, nil
+}
+
+func (s *jsonStreamer) nextNonSpace() (byte, error) {
+	for {
+		b, err := s.next()
+		if err != nil || !isJSONSpace(b) {
+			return b, err
+		}
+	}
+}
+
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// object consumes an object whose opening brace was read. path is the
+// dotted path of the object, or skipPath if nothing inside is wanted.
+func (s *jsonStreamer) object(path string) error {
+	c, err := s.nextNonSpace()
+	if err != nil {
+		return err
+	}
+	if c == '}' {
+		return nil
+	}
+
+	for {
+		if c != '"' {
+			return errJSONSyntax
+		}
+		key, err := s.str(path != skipPath)
+		if err != nil {
+			return err
+		}
+		if c, err = s.nextNonSpace(); err != nil {
+			return err
+		}
+		if c != ':' {
+			return errJSONSyntax
+		}
+		if c, err = s.nextNonSpace(); err != nil {
+			return err
+		}
+
+		// A key with a dot would alias a nested path; no wanted key has one
+		child := skipPath
+		if path != skipPath && !strings.Contains(key, ".") {
+			child = key
+			if path != "" {
+				child = path + "." + key
+			}
+		}
+
+		var pending byte
+		if streamedFields[child] {
+			s.capturing, s.capture, s.overflow = true, []byte{c}, false
+			pending, err = s.value(skipPath, c)
+			if pending != 0 && !s.overflow && len(s.capture) > 0 {
+				// The byte that ended a number or literal isn't part of it
+				s.capture = s.capture[:len(s.capture)-1]
+			}
+			s.fields[child] = s.capture
+			if s.overflow {
+				s.fields[child] = nil
+			}
+			s.capturing = false
+		} else {
+			if !streamedParents[child] {
+				child = skipPath
+			}
+			pending, err = s.value(child, c)
+		}
+		if err != nil {
+			return err
+		}
+
+		if pending == 0 || isJSONSpace(pending) {
+			if c, err = s.nextNonSpace(); err != nil {
+				return err
+			}
+		} else {
+			c = pending
+		}
+		if c == '}' {
+			return nil
+		}
+		if c != ',' {
+			return errJSONSyntax
+		}
+		if c, err = s.nextNonSpace(); err != nil {
+			return err
+		}
+	}
+}
+
+// array consumes an array whose opening bracket was read
+func (s *jsonStreamer) array() error {
+	c, err := s.nextNonSpace()
+	if err != nil {
+		return err
+	}
+	if c == ']' {
+		return nil
+	}
+
+	for {
+		pending, err := s.value(skipPath, c)
+		if err != nil {
+			return err
+		}
+		if pending == 0 || isJSONSpace(pending) {
+			if c, err = s.nextNonSpace(); err != nil {
+				return err
+			}
+		} else {
+			c = pending
+		}
+		if c == ']' {
+			return nil
+		}
+		if c != ',' {
+			return errJSONSyntax
+		}
+		if c, err = s.nextNonSpace(); err != nil {
+			return err
+		}
+	}
+}
+
+// value consumes the value starting with c. Numbers and literals only end
+// at the following byte, which is returned as pending; otherwise pending is 0.
+func (s *jsonStreamer) value(path string, c byte) (byte, error) {
+	switch c {
+	case '{':
+		return 0, s.object(path)
+	case '[':
+		return 0, s.array()
+	case '"':
+		_, err := s.str(false)
+		return 0, err
+	}
+
+	for {
+		b, err := s.next()
+		if err != nil {
+			return 0, err
+		}
+		if b == ',' || b == '}' || b == ']' || isJSONSpace(b) {
+			return b, nil
+		}
+	}
+}
+
+// str consumes a string whose opening quote was read, returning its
+// contents if keep is set. Only short strings (object keys) are kept; a
+// longer one comes back as skipPath, which never names a wanted field.
+func (s *jsonStreamer) str(keep bool) (string, error) {
+	var buf []byte
+	escaped := false
+	for {
+		b, err := s.next()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case '"':
+			if !keep || len(buf) > maxKeyBytes {
+				return skipPath, nil
+			}
+			if !escaped {
+				return string(buf), nil
+			}
+			// Keys match after unescaping, as they do for json.Unmarshal
+			var key string
+			if err := json.Unmarshal(append(append([]byte{'"'}, buf...), '"'), &key); err != nil {
+				return "", errJSONSyntax
+			}
+			return key, nil
+		case '\\':
+			escape, err := s.next()
+			if err != nil {
+				return "", err
+			}
+			escaped = true
+			if keep && len(buf) <= maxKeyBytes {
+				buf = append(buf, b, escape)
+			}
+		default:
+			if keep && len(buf) <= maxKeyBytes {
+				buf = append(buf, b)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDecodeLongLine checks that the streaming decoder reads the same entry
+// as json.Unmarshal does
+func TestDecodeLongLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"assistant", `{"type":"assistant","timestamp":"2025-01-02T03:04:05.000Z","cwd":"/home/dev/app","sessionId":"s1","message":{"id":"msg_1","model":"claude-sonnet-4-5","usage":{"input_tokens":1,"output_tokens":2,"cache_creation_input_tokens":3,"cache_read_input_tokens":4}}}`},
+		{"whitespace", " {\n\t\"type\" : \"assistant\" ,\r\n \"message\" : { \"id\" : \"msg_1\" , \"usage\" : { \"input_tokens\" : 5 } } } \n"},
+		{"usage first", `{"message":{"usage":{"output_tokens":7,"cache_creation":{"ephemeral_5m_input_tokens":1,"ephemeral_1h_input_tokens":2}},"model":"m","id":"msg_2"},"type":"assistant"}`},
+		{"tool result", `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","content":"a \"quoted\" {brace} [bracket] \\ back\\slash, \u00e9 \ud83d\ude00","is_error":false}]},"timestamp":"2025-01-02T03:04:05Z"}`},
+		{"literals", `{"a":123,"b":-1.5e3,"c":true,"d":false,"e":null,"f":[1,[2,{"g":3}],"h"],"type":"assistant"}`},
+		{"null usage", `{"type":"assistant","message":{"id":"msg_3","usage":null}}`},
+		{"empty values", `{"type":"","message":{},"cwd":"","x":{},"y":[]}`},
+		{"escaped key", `{"typ\u0065":"assistant","message":{"\u0069d":"msg_4"}}`},
+		{"escaped key aliasing a parent", `{"message\u0041":{"id":"wrong","usage":{"input_tokens":9}},"message":{"id":"msg_5"}}`},
+		{"escaped key aliasing a field", `{"type\"":"wrong","type":"assistant","message":{"id\\":"wrong"}}`},
+		{"dotted key", `{"message":{"id":"msg_6"},"message.id":"wrong"}`},
+		{"nested message", `{"data":{"message":{"id":"wrong","usage":{"input_tokens":9}}},"type":"progress"}`},
+		{"duplicate keys", `{"type":"user","type":"assistant","message":{"id":"a","id":"b"}}`},
+		{"escaped value", `{"type":"assistant","cwd":"C:\\Users\\dev\\app","sessionId":"\u0073\u0031"}`},
+		{"long key", `{"` + strings.Repeat("k", 1000) + `":1,"type":"assistant"}`},
+		{"truncated", `{"type":"assistant","message":{"id":"msg_7"`},
+		{"missing colon", `{"type" "assistant"}`},
+		{"missing comma", `{"type":"assistant" "cwd":"x"}`},
+		{"not an object", `["type","assistant"]`},
+		{"bad escape in key", `{"ty\x":"assistant"}`},
+		{"empty", ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want ClaudeEntry
+			wantErr := json.Unmarshal([]byte(tt.line), &want)
+
+			var got ClaudeEntry
+			line := &longLine{prefix: []byte(tt.line), r: bufio.NewReader(strings.NewReader(""))}
+			gotErr := decodeLongLine(line, &got)
+
+			if (gotErr != nil) != (wantErr != nil) {
+				t.Fatalf("error = %v, json.Unmarshal error = %v", gotErr, wantErr)
+			}
+			if wantErr == nil && !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v (usage %+v), want %+v (usage %+v)", got, got.Message.Usage, want, want.Message.Usage)
+			}
+		})
+	}
+}
+
+// TestDecodeLongLineRest checks that a line continuing past the prefix is
+// read up to its newline and no further
+func TestDecodeLongLineRest(t *testing.T) {
+	text := `{"type":"assistant","message":{"id":"msg_1","usage":{"input_tokens":1}}}`
+	rest := bufio.NewReader(strings.NewReader(text[20:] + "\n" + "next line\n"))
+	line := &longLine{prefix: []byte(text[:20]), r: rest}
+
+	var entry ClaudeEntry
+	if err := decodeLongLine(line, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Message.ID != "msg_1" || entry.Message.Usage == nil || entry.Message.Usage.InputTokens != 1 {
+		t.Errorf("got %+v", entry)
+	}
+	if !line.complete || line.size() != int64(len(text)+1) {
+		t.Errorf("complete = %v, size = %d; want true, %d", line.complete, line.size(), len(text)+1)
+	}
+	if next, _ := rest.ReadString('\n'); next != "next line\n" {
+		t.Errorf("next line = %q", next)
+	}
+}
+
+// TestProcessJSONLFileLongLine parses a transcript with a line over
+// maxLineBytes between two ordinary ones
+func TestProcessJSONLFileLongLine(t *testing.T) {
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+
+	// Usage comes after the large content, as in a real transcript
+	long := `{"type":"assistant","timestamp":"` + timestamp + `","message":{"id":"long","model":"claude-sonnet-4-5","content":[{"type":"text","text":"` +
+		strings.Repeat("x", 2*maxLineBytes) + `"}],"usage":{"input_tokens":10,"output_tokens":42}}}`
+	first := assistantLine("first", timestamp, 1)
+	last := assistantLine("last", timestamp, 3)
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	content := first + "\n" + long + "\n" + last + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(map[string]*MessageDataEntry)
+	var diagnostics Diagnostics
+	offset, err := processJSONLFile(path, "project", 0, messages, time.Time{}, &diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if offset != int64(len(content)) {
+		t.Errorf("offset = %d, want %d", offset, len(content))
+	}
+	if diagnostics.Lines != 3 || diagnostics.LongLines != 1 || diagnostics.skippedLines() != 0 {
+		t.Errorf("lines = %d, long lines = %d, skipped = %d; want 3, 1, 0",
+			diagnostics.Lines, diagnostics.LongLines, diagnostics.skippedLines())
+	}
+	if entry := messages["long"]; entry == nil || entry.Usage.OutputTokens != 42 || entry.Model != "claude-sonnet-4-5" {
+		t.Errorf("long message = %+v", entry)
+	}
+	if entry := messages["last"]; entry == nil || entry.Usage.OutputTokens != 3 {
+		t.Errorf("message after the long line = %+v", entry)
+	}
+
+	// Resuming after the long line reads only the last one
+	resumed := make(map[string]*MessageDataEntry)
+	start := int64(len(first) + 1 + len(long) + 1)
+	offset, err = processJSONLFile(path, "project", start, resumed, time.Time{}, &Diagnostics{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != int64(len(content)) || len(resumed) != 1 || resumed["last"] == nil {
+		t.Errorf("resumed at %d: offset = %d, messages = %v", start, offset, resumed)
+	}
+}
+
+// TestProcessJSONLFilePartialLongLine leaves a long line still being
+// written for the next read
+func TestProcessJSONLFilePartialLongLine(t *testing.T) {
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	first := assistantLine("first", timestamp, 1)
+	partial := `{"type":"assistant","message":{"content":"` + strings.Repeat("x", 2*maxLineBytes)
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, []byte(first+"\n"+partial), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(map[string]*MessageDataEntry)
+	var diagnostics Diagnostics
+	offset, err := processJSONLFile(path, "project", 0, messages, time.Time{}, &diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != int64(len(first)+1) {
+		t.Errorf("offset = %d, want %d", offset, len(first)+1)
+	}
+	if len(messages) != 1 || diagnostics.skippedLines() != 0 {
+		t.Errorf("messages = %d, skipped = %d; want 1, 0", len(messages), diagnostics.skippedLines())
+	}
+}
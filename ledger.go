@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UploadLedger remembers what a sink last delivered, so the "changed" upload
+// mode can leave out days the server already has
+type UploadLedger struct {
+	Timezone     string `json:"timezone"`
+	LastFullSync int64  `json:"lastFullSync"`
+
+	// Digest of each day as last uploaded, keyed by date
+	Days map[string]string `json:"days"`
+
+	path string
+}
+
+// LedgerUpdate is what delivering a payload tells the ledger. It travels
+// with the spooled payload, so one delivered on a later cycle is recorded.
+type LedgerUpdate struct {
+	// Set when the payload held only changed days
+	Partial  bool   `json:"partial,omitempty"`
+	Timezone string `json:"timezone"`
+
+	// Digest of each day in the payload, keyed by date
+	Days map[string]string `json:"days"`
+}
+
+// newLedgerUpdate returns the update for delivering payload
+func newLedgerUpdate(payload *UsageData) *LedgerUpdate {
+	update := &LedgerUpdate{
+		Partial:  payload.Partial,
+		Timezone: payload.Timezone,
+		Days:     make(map[string]string, len(payload.Daily)),
+	}
+	for _, day := range payload.Daily {
+		update.Days[day.Date] = dayDigest(day)
+	}
+	return update
+}
+
+func getLedgerDir() string {
+	return filepath.Join(getConfigDir(), "ledger")
+}
+
+// loadUploadLedger reads the ledger of the named sink, returning an empty
+// one (which forces a full upload) if it is missing or unreadable
+func loadUploadLedger(sinkName string) *UploadLedger {
+	ledger := &UploadLedger{path: filepath.Join(getLedgerDir(), sinkName+".json")}
+
+	if data, err := os.ReadFile(ledger.path); err == nil {
+		json.Unmarshal(data, ledger)
+	}
+	if ledger.Days == nil {
+		ledger.Days = make(map[string]string)
+	}
+	return ledger
+}
+
+// save writes the ledger atomically
+func (l *UploadLedger) save() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(l.path, data)
+}
+
+// changedDays returns the days to upload: every day when a full resync is
+// due, otherwise only days that are new or differ from their last upload
+func (l *UploadLedger) changedDays(usageData *UsageData, resyncInterval time.Duration) *UsageData {
+	lastFullSync := time.Unix(l.LastFullSync, 0)
+	if l.LastFullSync == 0 || time.Since(lastFullSync) >= resyncInterval || l.Timezone != usageData.Timezone {
+		return usageData
+	}
+
+	changed := &UsageData{Timezone: usageData.Timezone, Partial: true, Daily: []DailyStats{}}
+	changedDates := make(map[string]bool)
+	for _, day := range usageData.Daily {
+		if l.Days[day.Date] != dayDigest(day) {
+			changed.Daily = append(changed.Daily, day)
+			changedDates[day.Date] = true
+		}
+	}
+
+	// Hours and blocks go along with the days they fall on; timestamps are
+	// RFC 3339 in the same zone, so their date prefix is the day
+	for _, hour := range usageData.Hourly {
+		if changedDates[hour.Hour[:10]] {
+			changed.Hourly = append(changed.Hourly, hour)
+		}
+	}
+	for _, block := range usageData.Blocks {
+		if block.Active || changedDates[block.Start[:10]] || changedDates[block.LastMessage[:10]] {
+			changed.Blocks = append(changed.Blocks, block)
+		}
+	}
+	return changed
+}
+
+// record notes a successful upload
+func (l *UploadLedger) record(update *LedgerUpdate) {
+	if !update.Partial {
+		l.Timezone = update.Timezone
+		l.LastFullSync = time.Now().Unix()
+		l.Days = make(map[string]string)
+	}
+	for date, digest := range update.Days {
+		l.Days[date] = digest
+	}
+}
+
+// clone returns a copy that can be updated without touching l
+func (l *UploadLedger) clone() *UploadLedger {
+	clone := *l
+	clone.Days = make(map[string]string, len(l.Days))
+	for date, digest := range l.Days {
+		clone.Days[date] = digest
+	}
+	return &clone
+}
+
+// dayDigest hashes everything uploaded for a day, including the breakdowns
+func dayDigest(day DailyStats) string {
+	data, _ := json.Marshal(day)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
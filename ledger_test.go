@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangedDays(t *testing.T) {
+	day := func(date string, tokens int64) DailyStats {
+		return DailyStats{Date: date, TokenTotals: TokenTotals{TotalTokens: tokens}}
+	}
+	uploaded := &UsageData{Timezone: "Asia/Seoul", Daily: []DailyStats{day("2025-01-01", 10), day("2025-01-02", 20)}}
+	current := &UsageData{
+		Timezone: "Asia/Seoul",
+		Daily:    []DailyStats{day("2025-01-01", 10), day("2025-01-02", 25), day("2025-01-03", 5)},
+		Hourly: []HourlyStats{
+			{Hour: "2025-01-01T09:00:00+09:00"},
+			{Hour: "2025-01-02T23:00:00+09:00"},
+			{Hour: "2025-01-03T00:00:00+09:00"},
+		},
+		Blocks: []SessionBlock{
+			{Start: "2025-01-01T09:00:00+09:00", LastMessage: "2025-01-01T10:00:00+09:00"},
+			{Start: "2025-01-01T22:00:00+09:00", LastMessage: "2025-01-02T01:00:00+09:00"},
+			{Start: "2024-12-31T09:00:00+09:00", LastMessage: "2024-12-31T10:00:00+09:00", Active: true},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		lastFull    time.Duration
+		timezone    string
+		wantPartial bool
+		wantDays    []string
+		wantHours   int
+		wantBlocks  int
+	}{
+		{"changed and new days", time.Hour, "Asia/Seoul", true, []string{"2025-01-02", "2025-01-03"}, 2, 2},
+		{"resync due", 25 * time.Hour, "Asia/Seoul", false, []string{"2025-01-01", "2025-01-02", "2025-01-03"}, 3, 3},
+		{"timezone changed", time.Hour, "UTC", false, []string{"2025-01-01", "2025-01-02", "2025-01-03"}, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := &UploadLedger{Days: make(map[string]string)}
+			ledger.record(newLedgerUpdate(uploaded))
+			ledger.LastFullSync = time.Now().Add(-tt.lastFull).Unix()
+			ledger.Timezone = tt.timezone
+
+			payload := ledger.changedDays(current, 24*time.Hour)
+			var days []string
+			for _, day := range payload.Daily {
+				days = append(days, day.Date)
+			}
+			if payload.Partial != tt.wantPartial || !reflect.DeepEqual(days, tt.wantDays) {
+				t.Errorf("got partial %v with days %v, want %v with %v", payload.Partial, days, tt.wantPartial, tt.wantDays)
+			}
+			// Hours and blocks on unchanged days are left out; an active
+			// block always goes along
+			if len(payload.Hourly) != tt.wantHours || len(payload.Blocks) != tt.wantBlocks {
+				t.Errorf("got %d hours and %d blocks, want %d and %d", len(payload.Hourly), len(payload.Blocks), tt.wantHours, tt.wantBlocks)
+			}
+		})
+	}
+
+	// Nothing changed since the last upload
+	ledger := &UploadLedger{Days: make(map[string]string)}
+	ledger.record(newLedgerUpdate(current))
+	if payload := ledger.changedDays(current, 24*time.Hour); !payload.Partial || len(payload.Daily) != 0 {
+		t.Errorf("unchanged data: partial %v with %d days, want an empty partial payload", payload.Partial, len(payload.Daily))
+	}
+
+	// An empty ledger has never had a full upload
+	empty := &UploadLedger{Days: make(map[string]string)}
+	if payload := empty.changedDays(current, 24*time.Hour); payload.Partial {
+		t.Error("first upload is partial, want every day")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// lockTakeoverTimeout bounds how long run --force waits for the previous
+	// instance to finish its final upload and exit
+	lockTakeoverTimeout = time.Minute
+
+	// lockWaitInterval is how often an instance started by the service
+	// manager checks whether the running one has exited
+	lockWaitInterval = 5 * time.Second
+)
+
+// errLockHeld is returned by tryLockFile when another process holds the lock
+var errLockHeld = errors.New("lock is held by another process")
+
+// errLockWaitInterrupted means a stop signal arrived while waiting for the lock
+var errLockWaitInterrupted = errors.New("interrupted while waiting for the running instance to exit")
+
+// RunLock keeps a second daemon from running. It is an OS file lock, which
+// is released when the process exits however it ends, so a lock can never
+// outlive its holder; the PID in the file is only there to be shown.
+type RunLock struct {
+	file *os.File
+}
+
+// LockHeldError reports the live instance that holds the lock
+type LockHeldError struct {
+	PID int
+}
+
+func (e *LockHeldError) Error() string {
+	if e.PID == 0 {
+		return "another claude-monitor is already running"
+	}
+	return fmt.Sprintf("another claude-monitor is already running (PID %d)", e.PID)
+}
+
+func getLockPath() string {
+	return filepath.Join(getConfigDir(), "monitor.pid")
+}
+
+// acquireRunLock takes the lock for this process. If another instance holds
+// it, that is an error, unless force is set, in which case that instance is
+// stopped first.
+func acquireRunLock(force bool) (*RunLock, error) {
+	if err := os.MkdirAll(getConfigDir(), 0700); err != nil {
+		return nil, err
+	}
+
+	// The file is never removed: a process could otherwise lock a file
+	// that was just unlinked while another one locks its replacement
+	file, err := os.OpenFile(getLockPath(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// status holds the lock briefly to check it, so look twice
+	err = tryLockFile(file, true)
+	if err == errLockHeld {
+		time.Sleep(100 * time.Millisecond)
+		err = tryLockFile(file, true)
+	}
+	if err == errLockHeld {
+		pid := readLockPID(file)
+		if !force {
+			file.Close()
+			return nil, &LockHeldError{PID: pid}
+		}
+		err = takeOverLock(file, pid)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	lock := &RunLock{file: file}
+	if err := lock.writePID(); err != nil {
+		lock.release()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// waitForRunLock waits until the instance holding the lock exits, then takes
+// the lock. A stop signal meanwhile returns errLockWaitInterrupted.
+func waitForRunLock(held *LockHeldError, logger *log.Logger) (*RunLock, error) {
+	logger.Printf("%v; waiting for it to exit", held)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(lockWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sigChan:
+			return nil, errLockWaitInterrupted
+		case <-ticker.C:
+			lock, err := acquireRunLock(false)
+			if _, stillHeld := err.(*LockHeldError); stillHeld {
+				continue
+			}
+			return lock, err
+		}
+	}
+}
+
+// takeOverLock stops the instance holding the lock on file and takes the
+// lock once it has exited, after its final upload
+func takeOverLock(file *os.File, pid int) error {
+	if pid == 0 {
+		return errors.New("the running instance has not written its PID yet, try again")
+	}
+	if err := terminateProcess(pid); err != nil {
+		return fmt.Errorf("failed to stop PID %d: %w", pid, err)
+	}
+
+	deadline := time.Now().Add(lockTakeoverTimeout)
+	for {
+		err := tryLockFile(file, true)
+		if err != errLockHeld {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("PID %d did not exit within %s", pid, lockTakeoverTimeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func (l *RunLock) writePID() error {
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := l.file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
+
+// release clears the PID and unlocks
+func (l *RunLock) release() {
+	l.file.Truncate(0)
+	unlockFile(l.file)
+	l.file.Close()
+}
+
+// lockHolder returns the PID in the lock file and whether the process that
+// wrote it still holds the lock. A PID of 0 means none was recorded, e.g.
+// after a clean exit; a PID that is not running was left by a crash.
+func lockHolder() (int, bool) {
+	file, err := os.Open(getLockPath())
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	pid := readLockPID(file)
+	if err := tryLockFile(file, false); err != nil {
+		return pid, err == errLockHeld
+	}
+	unlockFile(file)
+	return pid, false
+}
+
+// readLockPID returns the PID recorded in the lock file, or 0
+func readLockPID(file *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := file.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+// TestRunLock checks that the lock admits one holder at a time and that a
+// PID left in the file without a lock doesn't block the next run
+func TestRunLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", os.Getenv("HOME"))
+
+	// Left by a crashed instance whose PID is now used by a live process
+	if err := os.MkdirAll(getConfigDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(getLockPath(), []byte(strconv.Itoa(os.Getppid())+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid, running := lockHolder(); pid != os.Getppid() || running {
+		t.Errorf("lockHolder() = %d, %v before locking; want %d, false", pid, running, os.Getppid())
+	}
+
+	lock, err := acquireRunLock(false)
+	if err != nil {
+		t.Fatalf("acquireRunLock over a stale PID: %v", err)
+	}
+	if pid, running := lockHolder(); pid != os.Getpid() || !running {
+		t.Errorf("lockHolder() = %d, %v; want %d, true", pid, running, os.Getpid())
+	}
+
+	_, err = acquireRunLock(false)
+	if held, ok := err.(*LockHeldError); !ok || held.PID != os.Getpid() {
+		t.Errorf("second acquireRunLock: %v, want a LockHeldError for PID %d", err, os.Getpid())
+	}
+
+	lock.release()
+	if pid, running := lockHolder(); pid != 0 || running {
+		t.Errorf("lockHolder() = %d, %v after release; want 0, false", pid, running)
+	}
+
+	lock, err = acquireRunLock(false)
+	if err != nil {
+		t.Fatalf("acquireRunLock after release: %v", err)
+	}
+	lock.release()
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 )
 
+const version = "1.0.0"
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -22,10 +24,22 @@ func main() {
 		handleStatus()
 	case "run":
 		handleRun()
+	case "sync":
+		handleSync()
 	case "test":
 		handleTest()
+	case "report":
+		handleReport()
+	case "export":
+		handleExport()
+	case "blocks":
+		handleBlocks()
+	case "watch":
+		handleWatch()
+	case "doctor":
+		handleDoctor()
 	case "version":
-		fmt.Println("claude-monitor v1.0.0")
+		fmt.Printf("claude-monitor v%s\n", version)
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -46,6 +60,12 @@ Commands:
   uninstall   Remove background service
   status      Show service status and last upload info
   run         Run in foreground (manual mode)
+  sync        Make the running service upload now and show the result
+  report      Show token usage by day, week, month, model or project
+  export      Write per-message usage as CSV, NDJSON or JSON
+  blocks      Show the current 5-hour usage block and time until reset
+  watch       Live view of session, block and daily usage as it happens
+  doctor      Check config, transcripts, server, service and log, and suggest fixes
   version     Show version
   help        Show this help
 
@@ -53,11 +73,45 @@ Install Options:
   --email <email>       User email (required for first install)
   --server <url>        Server URL (default: http://10.12.200.99:3498)
   --interval <seconds>  Upload interval in seconds (default: 600)
+  --pricing <file>      JSON file overriding the built-in model pricing
+  --token <token>       API token sent as a bearer header
+  --signing-secret <s>  Secret for HMAC-SHA256 request signing
+  --ca-cert <file>      Extra CA certificate bundle (PEM) to trust
+  --client-cert <file>  Client certificate (PEM) for mutual TLS
+  --client-key <file>   Client private key (PEM) for mutual TLS
+  --proxy <url>         HTTP/HTTPS proxy for uploads
+  --no-proxy <hosts>    Comma-separated hosts, domains or CIDRs to reach directly
+  --metrics-addr <addr> Serve Prometheus metrics, e.g. 127.0.0.1:9464
+  --timezone <zone>     IANA zone days are cut in (default: system zone)
+  --lookback-days <n>   Days of usage to collect and upload (default: 90)
+  --upload-mode <mode>  full, or changed to upload only changed days (default: full)
+  --resync-hours <n>    Full upload interval in changed mode (default: 24)
+  --hash-projects       Upload a salted hash instead of project paths
+  --project-salt <salt> Salt for project hashing (default: random per machine)
+
+Run Options:
+  --force               Stop an instance that is already running and take over
+  (install options are also accepted and saved to the config)
+
+Report Options:
+  --by <group>          day, week, month, model or project (default: day)
+  --since <YYYY-MM-DD>  First day to include
+  --until <YYYY-MM-DD>  Last day to include
+  --cost                Add an estimated cost column
+  --json                Print JSON instead of a table
+  --csv                 Print CSV instead of a table
+
+Export Options:
+  --format <format>     csv, ndjson or json (default: csv)
+  --granularity <g>     message, hour or day (default: message)
+  --output <file>       Write to a file instead of stdout
 
 Examples:
   claude-monitor install --email your@email.com
   claude-monitor install --email your@email.com --interval 300
   claude-monitor status
+  claude-monitor report --by week --since 2025-01-01 --cost
+  claude-monitor export --format ndjson --granularity hour --output usage.ndjson
   claude-monitor uninstall
   claude-monitor run`)
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tokenTypes are the values of the "type" label on token metrics
+var tokenTypes = []string{"input", "output", "cache_write", "cache_read"}
+
+// usageSeries is the usage of one model within one project over the whole
+// collection window
+type usageSeries struct {
+	model   string
+	project string
+	totals  TokenTotals
+}
+
+// startMetricsServer serves Prometheus metrics on addr in the background
+func startMetricsServer(addr string, live *liveConfig, state *DaemonState, logger *log.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, live.get(), state)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Printf("Metrics server error: %v", err)
+		}
+	}()
+
+	return server
+}
+
+// writeMetrics renders the daemon state in the Prometheus text format
+func writeMetrics(w http.ResponseWriter, config *Config, state *DaemonState) {
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	usageData, collectionTime, collectionDuration, collectionCount := state.lastCollection()
+
+	// Token totals cover the collection window, so they drop when a day ages
+	// out; they are gauges rather than counters for that reason
+	if usageData != nil && config.HashProjectPaths {
+		usageData = anonymizeProjects(usageData, config.ProjectHashSalt)
+	}
+	series := usageSeriesFrom(usageData)
+
+	writeHeader(out, "claude_monitor_tokens", "gauge", "Tokens used in the collection window")
+	for _, s := range series {
+		values := []int64{s.totals.TotalInputTokens, s.totals.TotalOutputTokens,
+			s.totals.TotalCacheWriteTokens, s.totals.TotalCacheReadTokens}
+		for i, tokenType := range tokenTypes {
+			fmt.Fprintf(out, "claude_monitor_tokens{model=%s,project=%s,type=%s} %d\n",
+				quoteLabel(s.model), quoteLabel(s.project), quoteLabel(tokenType), values[i])
+		}
+	}
+
+	writeHeader(out, "claude_monitor_requests", "gauge", "API requests in the collection window")
+	for _, s := range series {
+		fmt.Fprintf(out, "claude_monitor_requests{model=%s,project=%s} %d\n",
+			quoteLabel(s.model), quoteLabel(s.project), s.totals.RequestCount)
+	}
+
+	writeHeader(out, "claude_monitor_estimated_cost_usd", "gauge", "Estimated cost in USD in the collection window")
+	for _, s := range series {
+		fmt.Fprintf(out, "claude_monitor_estimated_cost_usd{model=%s,project=%s} %g\n",
+			quoteLabel(s.model), quoteLabel(s.project), s.totals.EstimatedCostUSD)
+	}
+
+	sinks := state.snapshotSinks()
+
+	writeHeader(out, "claude_monitor_uploads_total", "counter", "Upload attempts per sink")
+	for _, sink := range sinks {
+		fmt.Fprintf(out, "claude_monitor_uploads_total{sink=%s} %d\n", quoteLabel(sink.Name), sink.Uploads)
+	}
+
+	writeHeader(out, "claude_monitor_upload_failures_total", "counter", "Failed uploads per sink")
+	for _, sink := range sinks {
+		fmt.Fprintf(out, "claude_monitor_upload_failures_total{sink=%s} %d\n", quoteLabel(sink.Name), sink.Failures)
+	}
+
+	writeHeader(out, "claude_monitor_last_successful_upload_timestamp_seconds", "gauge", "Unix time of the last successful upload per sink")
+	for _, sink := range sinks {
+		if !sink.LastSuccess.IsZero() {
+			fmt.Fprintf(out, "claude_monitor_last_successful_upload_timestamp_seconds{sink=%s} %d\n",
+				quoteLabel(sink.Name), sink.LastSuccess.Unix())
+		}
+	}
+
+	writeHeader(out, "claude_monitor_collections_total", "counter", "Completed collection runs")
+	fmt.Fprintf(out, "claude_monitor_collections_total %d\n", collectionCount)
+
+	if !collectionTime.IsZero() {
+		writeHeader(out, "claude_monitor_collection_duration_seconds", "gauge", "Duration of the last collection run")
+		fmt.Fprintf(out, "claude_monitor_collection_duration_seconds %g\n", collectionDuration.Seconds())
+
+		writeHeader(out, "claude_monitor_last_collection_timestamp_seconds", "gauge", "Unix time of the last collection run")
+		fmt.Fprintf(out, "claude_monitor_last_collection_timestamp_seconds %d\n", collectionTime.Unix())
+	}
+
+	diagnostics := state.totalDiagnostics()
+
+	writeHeader(out, "claude_monitor_transcript_bytes_total", "counter", "Transcript bytes read")
+	fmt.Fprintf(out, "claude_monitor_transcript_bytes_total %d\n", diagnostics.BytesRead)
+
+	writeHeader(out, "claude_monitor_transcript_lines_total", "counter", "Transcript lines read")
+	fmt.Fprintf(out, "claude_monitor_transcript_lines_total %d\n", diagnostics.Lines)
+
+	writeHeader(out, "claude_monitor_transcript_long_lines_total", "counter", "Transcript lines over 1 MB, decoded by streaming")
+	fmt.Fprintf(out, "claude_monitor_transcript_long_lines_total %d\n", diagnostics.LongLines)
+
+	writeHeader(out, "claude_monitor_transcript_skipped_lines_total", "counter", "Transcript lines skipped, by reason")
+	for _, reason := range diagnostics.skipReasons() {
+		fmt.Fprintf(out, "claude_monitor_transcript_skipped_lines_total{reason=%s} %d\n", quoteLabel(reason), diagnostics.Skipped[reason])
+	}
+
+	writeHeader(out, "claude_monitor_transcript_duplicate_messages_total", "counter", "Transcript lines repeating a message ID already read")
+	fmt.Fprintf(out, "claude_monitor_transcript_duplicate_messages_total %d\n", diagnostics.DuplicateMessages)
+
+	writeHeader(out, "claude_monitor_transcript_file_errors_total", "counter", "Transcript files or directories that could not be read")
+	fmt.Fprintf(out, "claude_monitor_transcript_file_errors_total %d\n", diagnostics.FileErrors)
+
+	writeHeader(out, "claude_monitor_start_time_seconds", "gauge", "Unix time the daemon started")
+	fmt.Fprintf(out, "claude_monitor_start_time_seconds %d\n", state.startTime.Unix())
+}
+
+// usageSeriesFrom sums the per-project model breakdowns over all days
+func usageSeriesFrom(usageData *UsageData) []usageSeries {
+	if usageData == nil {
+		return nil
+	}
+
+	totals := make(map[[2]string]*TokenTotals)
+	for _, day := range usageData.Daily {
+		for _, project := range day.Projects {
+			for _, model := range project.Models {
+				key := [2]string{model.Model, project.Project}
+				if totals[key] == nil {
+					totals[key] = &TokenTotals{}
+				}
+				totals[key].merge(model.TokenTotals)
+			}
+		}
+	}
+
+	series := make([]usageSeries, 0, len(totals))
+	for key, t := range totals {
+		series = append(series, usageSeries{model: key[0], project: key[1], totals: *t})
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].model != series[j].model {
+			return series[i].model < series[j].model
+		}
+		return series[i].project < series[j].project
+	})
+	return series
+}
+
+func writeHeader(out *bufio.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(out, "# TYPE %s %s\n", name, metricType)
+}
+
+// quoteLabel escapes a label value per the Prometheus text format
+func quoteLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP aggregation temporality, see opentelemetry/proto/metrics/v1/metrics.proto
+const otlpTemporalityCumulative = 2
+
+// OTLPSink exports usage aggregates as OTLP/HTTP metrics in the JSON
+// encoding, so any OpenTelemetry collector can receive them. Values are
+// cumulative totals, so a failed export is simply superseded by the next one
+// and nothing is spooled.
+type OTLPSink struct {
+	name         string
+	endpoint     string
+	headers      map[string]string
+	email        string
+	hashProjects bool
+	projectSalt  string
+	location     *time.Location
+	client       *http.Client
+}
+
+// OTLP/JSON message types; 64-bit integers are encoded as strings per the
+// protobuf JSON mapping
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpMetric struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Unit        string  `json:"unit"`
+	Sum         otlpSum `json:"sum"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsInt             string         `json:"asInt,omitempty"`
+	AsDouble          *float64       `json:"asDouble,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func newOTLPSink(config *Config, sinkConfig SinkConfig) (*OTLPSink, error) {
+	if sinkConfig.ServerURL == "" {
+		return nil, fmt.Errorf("sink %q: otlp sink requires a serverUrl", sinkConfig.Name)
+	}
+
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := config.getLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	// Accept either the collector base URL or the full metrics endpoint
+	endpoint := strings.TrimSuffix(sinkConfig.ServerURL, "/")
+	if !strings.HasSuffix(endpoint, "/v1/metrics") {
+		endpoint += "/v1/metrics"
+	}
+
+	return &OTLPSink{
+		name:         sinkConfig.Name,
+		endpoint:     endpoint,
+		headers:      sinkConfig.Headers,
+		email:        config.Email,
+		hashProjects: config.HashProjectPaths,
+		projectSalt:  config.ProjectHashSalt,
+		location:     loc,
+		client:       client,
+	}, nil
+}
+
+func (s *OTLPSink) Name() string {
+	return s.name
+}
+
+func (s *OTLPSink) Send(usageData *UsageData, cancel <-chan struct{}) (*UploadResult, error) {
+	if len(usageData.Daily) == 0 {
+		return &UploadResult{Success: true, Message: "No data to export"}, nil
+	}
+
+	if s.hashProjects {
+		usageData = anonymizeProjects(usageData, s.projectSalt)
+	}
+
+	series := usageSeriesFrom(usageData)
+	body, err := json.Marshal(s.buildRequest(series, windowStart(usageData, s.location), time.Now()))
+	if err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return &UploadResult{
+			Success:    true,
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("Exported %d series to %s", len(series), s.endpoint),
+		}, nil
+	}
+
+	return &UploadResult{
+		Success:    false,
+		StatusCode: resp.StatusCode,
+		Message:    string(respBody),
+	}, fmt.Errorf("otlp export failed: HTTP %d", resp.StatusCode)
+}
+
+// buildRequest converts the usage series into cumulative sums. The totals
+// cover the collection window and can drop when a day ages out, so they
+// are not marked monotonic.
+func (s *OTLPSink) buildRequest(series []usageSeries, start time.Time, now time.Time) *otlpMetricsRequest {
+	startNano := strconv.FormatInt(start.UnixNano(), 10)
+	nowNano := strconv.FormatInt(now.UnixNano(), 10)
+
+	newSum := func(name string, description string, unit string) otlpMetric {
+		return otlpMetric{
+			Name:        name,
+			Description: description,
+			Unit:        unit,
+			Sum:         otlpSum{AggregationTemporality: otlpTemporalityCumulative},
+		}
+	}
+	tokens := newSum("claude_monitor.tokens", "Tokens used in the collection window", "{token}")
+	requests := newSum("claude_monitor.requests", "API requests in the collection window", "{request}")
+	cost := newSum("claude_monitor.estimated_cost", "Estimated cost in the collection window", "USD")
+
+	for _, sr := range series {
+		values := []int64{sr.totals.TotalInputTokens, sr.totals.TotalOutputTokens,
+			sr.totals.TotalCacheWriteTokens, sr.totals.TotalCacheReadTokens}
+		for i, tokenType := range tokenTypes {
+			tokens.Sum.DataPoints = append(tokens.Sum.DataPoints, otlpNumberDataPoint{
+				Attributes:        otlpAttributes("model", sr.model, "project", sr.project, "type", tokenType),
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				AsInt:             strconv.FormatInt(values[i], 10),
+			})
+		}
+
+		requests.Sum.DataPoints = append(requests.Sum.DataPoints, otlpNumberDataPoint{
+			Attributes:        otlpAttributes("model", sr.model, "project", sr.project),
+			StartTimeUnixNano: startNano,
+			TimeUnixNano:      nowNano,
+			AsInt:             strconv.Itoa(sr.totals.RequestCount),
+		})
+
+		costValue := sr.totals.EstimatedCostUSD
+		cost.Sum.DataPoints = append(cost.Sum.DataPoints, otlpNumberDataPoint{
+			Attributes:        otlpAttributes("model", sr.model, "project", sr.project),
+			StartTimeUnixNano: startNano,
+			TimeUnixNano:      nowNano,
+			AsDouble:          &costValue,
+		})
+	}
+
+	hostname, _ := os.Hostname()
+	return &otlpMetricsRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: otlpAttributes(
+				"service.name", "claude-monitor",
+				"service.version", version,
+				"host.name", hostname,
+				"user.email", s.email,
+				"os.type", runtime.GOOS,
+			)},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "claude-monitor", Version: version},
+				Metrics: []otlpMetric{tokens, requests, cost},
+			}},
+		}},
+	}
+}
+
+// otlpAttributes builds string attributes from alternating keys and values
+func otlpAttributes(keyValues ...string) []otlpKeyValue {
+	attributes := make([]otlpKeyValue, 0, len(keyValues)/2)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		attributes = append(attributes, otlpKeyValue{Key: keyValues[i], Value: otlpAnyValue{StringValue: keyValues[i+1]}})
+	}
+	return attributes
+}
+
+// windowStart returns midnight of the earliest day in the data, in the zone
+// the days were cut in
+func windowStart(usageData *UsageData, loc *time.Location) time.Time {
+	if len(usageData.Daily) > 0 {
+		if start, err := time.ParseInLocation("2006-01-02", usageData.Daily[0].Date, loc); err == nil {
+			return start
+		}
+	}
+	return time.Now()
+}
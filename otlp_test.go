@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOTLPSinkExport sends usage to a stub collector and checks the decoded
+// OTLP/JSON request
+func TestOTLPSinkExport(t *testing.T) {
+	var (
+		path   string
+		header http.Header
+		body   []byte
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	config := &Config{
+		Email:            "dev@example.com",
+		Timezone:         "UTC",
+		HashProjectPaths: true,
+		ProjectHashSalt:  "salt",
+	}
+	sink, err := newOTLPSink(config, SinkConfig{
+		Name:      "otel",
+		Type:      "otlp",
+		ServerURL: collector.URL + "/",
+		Headers:   map[string]string{"X-Api-Key": "secret"},
+	})
+	if err != nil {
+		t.Fatalf("newOTLPSink: %v", err)
+	}
+
+	const project = "/home/dev/app"
+	usageData := &UsageData{Daily: []DailyStats{{
+		Date: "2025-01-02",
+		Projects: []ProjectStats{{
+			Project: project,
+			Models: []ModelStats{{
+				Model: "claude-sonnet-4-5",
+				TokenTotals: TokenTotals{
+					TotalInputTokens:      10,
+					TotalOutputTokens:     20,
+					TotalCacheWriteTokens: 30,
+					TotalCacheReadTokens:  40,
+					TotalTokens:           100,
+					RequestCount:          3,
+					EstimatedCostUSD:      0.25,
+				},
+			}},
+		}},
+	}}}
+
+	result, err := sink.Send(usageData, nil)
+	if err != nil || !result.Success {
+		t.Fatalf("Send: %v (%+v)", err, result)
+	}
+
+	if path != "/v1/metrics" {
+		t.Errorf("path = %q, want /v1/metrics", path)
+	}
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := header.Get("X-Api-Key"); got != "secret" {
+		t.Errorf("X-Api-Key = %q, want secret", got)
+	}
+	if strings.Contains(string(body), project) {
+		t.Errorf("request contains the project path %q", project)
+	}
+
+	// 64-bit integers must be JSON strings per the protobuf JSON mapping
+	var raw struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Sum struct {
+						DataPoints []map[string]json.RawMessage `json:"dataPoints"`
+					} `json:"sum"`
+				} `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		t.Fatalf("decoding request: %v", err)
+	}
+	for _, metric := range raw.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		for _, point := range metric.Sum.DataPoints {
+			for _, field := range []string{"asInt", "startTimeUnixNano", "timeUnixNano"} {
+				if value, ok := point[field]; ok && !strings.HasPrefix(string(value), `"`) {
+					t.Errorf("%s = %s, want a string", field, value)
+				}
+			}
+		}
+	}
+
+	var request otlpMetricsRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("decoding request: %v", err)
+	}
+	if len(request.ResourceMetrics) != 1 {
+		t.Fatalf("got %d resource metrics, want 1", len(request.ResourceMetrics))
+	}
+	resource := attributeMap(request.ResourceMetrics[0].Resource.Attributes)
+	for key, want := range map[string]string{
+		"service.name":    "claude-monitor",
+		"service.version": version,
+		"user.email":      "dev@example.com",
+	} {
+		if resource[key] != want {
+			t.Errorf("resource %s = %q, want %q", key, resource[key], want)
+		}
+	}
+	if _, ok := resource["host.name"]; !ok {
+		t.Errorf("resource has no host.name")
+	}
+
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+
+	tokens := metrics["claude_monitor.tokens"]
+	if len(tokens.Sum.DataPoints) != len(tokenTypes) {
+		t.Fatalf("got %d token data points, want %d", len(tokens.Sum.DataPoints), len(tokenTypes))
+	}
+	wantTokens := map[string]string{"input": "10", "output": "20", "cache_write": "30", "cache_read": "40"}
+	for _, point := range tokens.Sum.DataPoints {
+		attributes := attributeMap(point.Attributes)
+		if attributes["project"] != hashProject("salt", project) {
+			t.Errorf("project = %q, want the salted hash", attributes["project"])
+		}
+		if attributes["model"] != "claude-sonnet-4-5" {
+			t.Errorf("model = %q, want claude-sonnet-4-5", attributes["model"])
+		}
+		if point.AsInt != wantTokens[attributes["type"]] {
+			t.Errorf("%s tokens = %q, want %q", attributes["type"], point.AsInt, wantTokens[attributes["type"]])
+		}
+	}
+	if tokens.Sum.AggregationTemporality != otlpTemporalityCumulative {
+		t.Errorf("temporality = %d, want cumulative", tokens.Sum.AggregationTemporality)
+	}
+
+	requests := metrics["claude_monitor.requests"]
+	if len(requests.Sum.DataPoints) != 1 || requests.Sum.DataPoints[0].AsInt != "3" {
+		t.Errorf("requests = %+v, want one data point of 3", requests.Sum.DataPoints)
+	}
+
+	cost := metrics["claude_monitor.estimated_cost"]
+	if len(cost.Sum.DataPoints) != 1 || cost.Sum.DataPoints[0].AsDouble == nil || *cost.Sum.DataPoints[0].AsDouble != 0.25 {
+		t.Errorf("cost = %+v, want one data point of 0.25", cost.Sum.DataPoints)
+	}
+}
+
+// TestOTLPSinkExportFailure reports a collector error as a failed export
+func TestOTLPSinkExportFailure(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer collector.Close()
+
+	sink, err := newOTLPSink(&Config{Timezone: "UTC"}, SinkConfig{Name: "otel", Type: "otlp", ServerURL: collector.URL + "/v1/metrics"})
+	if err != nil {
+		t.Fatalf("newOTLPSink: %v", err)
+	}
+
+	usageData := &UsageData{Daily: []DailyStats{{Date: "2025-01-02"}}}
+	result, err := sink.Send(usageData, nil)
+	if err == nil || result.Success || result.StatusCode != http.StatusBadRequest {
+		t.Errorf("Send = %+v, %v; want a failed HTTP 400 result", result, err)
+	}
+}
+
+func attributeMap(attributes []otlpKeyValue) map[string]string {
+	values := make(map[string]string, len(attributes))
+	for _, attribute := range attributes {
+		values[attribute.Key] = attribute.Value.StringValue
+	}
+	return values
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// ModelPricing holds USD prices per million tokens
+type ModelPricing struct {
+	Input        float64 `json:"input"`
+	Output       float64 `json:"output"`
+	CacheWrite5m float64 `json:"cacheWrite5m"`
+	CacheWrite1h float64 `json:"cacheWrite1h"`
+	CacheRead    float64 `json:"cacheRead"`
+}
+
+// PricingTable maps model ID prefixes to prices. The longest matching
+// prefix wins, so "claude-opus-4-5" takes precedence over "claude-opus-4".
+type PricingTable map[string]ModelPricing
+
+// defaultPricing is Anthropic's published API pricing
+var defaultPricing = PricingTable{
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite5m: 6.25, CacheWrite1h: 10, CacheRead: 0.50},
+	"claude-opus-4-1":   {Input: 15, Output: 75, CacheWrite5m: 18.75, CacheWrite1h: 30, CacheRead: 1.50},
+	"claude-opus-4":     {Input: 15, Output: 75, CacheWrite5m: 18.75, CacheWrite1h: 30, CacheRead: 1.50},
+	"claude-3-opus":     {Input: 15, Output: 75, CacheWrite5m: 18.75, CacheWrite1h: 30, CacheRead: 1.50},
+	"claude-sonnet-4-5": {Input: 3, Output: 15, CacheWrite5m: 3.75, CacheWrite1h: 6, CacheRead: 0.30},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite5m: 3.75, CacheWrite1h: 6, CacheRead: 0.30},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite5m: 3.75, CacheWrite1h: 6, CacheRead: 0.30},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite5m: 3.75, CacheWrite1h: 6, CacheRead: 0.30},
+	"claude-haiku-4-5":  {Input: 1, Output: 5, CacheWrite5m: 1.25, CacheWrite1h: 2, CacheRead: 0.10},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheWrite5m: 1, CacheWrite1h: 1.60, CacheRead: 0.08},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25, CacheWrite5m: 0.30, CacheWrite1h: 0.50, CacheRead: 0.03},
+}
+
+// loadPricing returns the built-in pricing table with entries from the
+// override file (if any) layered on top
+func loadPricing(pricingFile string) (PricingTable, error) {
+	table := make(PricingTable, len(defaultPricing))
+	for prefix, pricing := range defaultPricing {
+		table[prefix] = pricing
+	}
+
+	if pricingFile == "" {
+		return table, nil
+	}
+
+	data, err := os.ReadFile(pricingFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var overrides PricingTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing file %s: %w", pricingFile, err)
+	}
+
+	for prefix, pricing := range overrides {
+		table[prefix] = pricing
+	}
+
+	return table, nil
+}
+
+// lookup returns the pricing for a model ID by longest prefix match
+func (p PricingTable) lookup(model string) (ModelPricing, bool) {
+	var best string
+	for prefix := range p {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelPricing{}, false
+	}
+	return p[best], true
+}
+
+// cost estimates the USD cost of one message. Unknown models cost nothing.
+func (p PricingTable) cost(model string, usage *ClaudeUsage) float64 {
+	pricing, ok := p.lookup(model)
+	if !ok {
+		return 0
+	}
+
+	// Without the ephemeral breakdown every cache write is a 5-minute write
+	cacheWrite5m := usage.CacheCreationInputTokens
+	cacheWrite1h := 0
+	if cc := usage.CacheCreation; cc != nil && cc.Ephemeral5mInputTokens+cc.Ephemeral1hInputTokens > 0 {
+		cacheWrite5m = cc.Ephemeral5mInputTokens
+		cacheWrite1h = cc.Ephemeral1hInputTokens
+	}
+
+	return (float64(usage.InputTokens)*pricing.Input +
+		float64(usage.OutputTokens)*pricing.Output +
+		float64(cacheWrite5m)*pricing.CacheWrite5m +
+		float64(cacheWrite1h)*pricing.CacheWrite1h +
+		float64(usage.CacheReadInputTokens)*pricing.CacheRead) / 1e6
+}
+
+// roundCost trims floating point noise from summed costs
+func roundCost(cost float64) float64 {
+	return math.Round(cost*1e6) / 1e6
+}
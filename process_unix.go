@@ -0,0 +1,10 @@
+//go:build darwin || linux
+
+package main
+
+import "syscall"
+
+// terminateProcess asks the process to shut down cleanly
+func terminateProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
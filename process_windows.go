@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// terminateProcess ends the process; Windows has no signal to ask a console
+// process to shut down, so no final upload is made
+func terminateProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+)
+
+// projectFromPath returns the encoded project directory a transcript lives in,
+// i.e. the first path component below the Claude projects directory
+func projectFromPath(claudeDir string, path string) string {
+	rel, err := filepath.Rel(claudeDir, path)
+	if err != nil {
+		return ""
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 {
+		// Transcript sits directly in the projects directory
+		return ""
+	}
+	return parts[0]
+}
+
+// encodeProjectPath mirrors how Claude Code names project directories:
+// every character that isn't a letter or digit becomes '-'
+func encodeProjectPath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// resolveProjectPaths maps each encoded project directory to the real path
+// it was created for. The encoding is lossy, so the path is recovered from
+// the cwd recorded in the entries; a session that cd'ed into a subdirectory
+// doesn't match and is ignored. Directories without a match keep their
+// encoded name.
+func resolveProjectPaths(messageData map[string]*MessageDataEntry) map[string]string {
+	projectPaths := map[string]string{"": unknownProject}
+
+	for _, data := range messageData {
+		if _, ok := projectPaths[data.Project]; ok {
+			continue
+		}
+		if data.Cwd != "" && encodeProjectPath(data.Cwd) == data.Project {
+			projectPaths[data.Project] = data.Cwd
+		}
+	}
+
+	for _, data := range messageData {
+		if _, ok := projectPaths[data.Project]; !ok {
+			projectPaths[data.Project] = data.Project
+		}
+	}
+
+	return projectPaths
+}
+
+// hashProject returns a salted, truncated HMAC of the project path so the
+// server can tell projects apart without learning their names
+func hashProject(salt string, project string) string {
+	if project == unknownProject {
+		return project
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(project))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// anonymizeProjects returns a copy of the usage data with every project path
+// replaced by its salted hash
+func anonymizeProjects(usageData *UsageData, salt string) *UsageData {
+	anonymized := &UsageData{
+		Timezone: usageData.Timezone,
+		Partial:  usageData.Partial,
+		Daily:    make([]DailyStats, len(usageData.Daily)),
+		Hourly:   usageData.Hourly,
+		Blocks:   usageData.Blocks,
+	}
+	for i, day := range usageData.Daily {
+		projects := make([]ProjectStats, len(day.Projects))
+		for j, projectStats := range day.Projects {
+			projectStats.Project = hashProject(salt, projectStats.Project)
+			projects[j] = projectStats
+		}
+		day.Projects = projects
+		anonymized.Daily[i] = day
+	}
+	return anonymized
+}
+
+// generateProjectSalt returns a random salt for hashing project paths
+func generateProjectSalt() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configPollInterval is how often the daemon checks the config file for changes
+const configPollInterval = 5 * time.Second
+
+// secretConfigFields are logged only as changed, never with their values.
+// Sinks can carry tokens and headers, proxy URLs credentials.
+var secretConfigFields = map[string]bool{
+	"apiToken":        true,
+	"signingSecret":   true,
+	"projectHashSalt": true,
+	"httpProxy":       true,
+	"httpsProxy":      true,
+	"sinks":           true,
+}
+
+// liveConfig holds the config the daemon currently runs with
+type liveConfig struct {
+	mu     sync.Mutex
+	config *Config
+}
+
+func (c *liveConfig) get() *Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+func (c *liveConfig) set(config *Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = config
+}
+
+// configFileStamp identifies one version of the config file
+type configFileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statConfigFile() configFileStamp {
+	info, err := os.Stat(getConfigPath())
+	if err != nil {
+		return configFileStamp{}
+	}
+	return configFileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// loadReloadedConfig reads and validates the config file, the way run does
+// at startup
+func loadReloadedConfig() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Project hashing may have been enabled by editing the file; the salt
+	// is saved so the hashes stay the same from now on
+	if config.HashProjectPaths && config.ProjectHashSalt == "" {
+		config.ProjectHashSalt = generateProjectSalt()
+		if err := saveConfig(config); err != nil {
+			return nil, fmt.Errorf("failed to save config: %w", err)
+		}
+	}
+
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// configDiff describes each setting that differs between old and updated,
+// by its name in the config file
+func configDiff(old *Config, updated *Config) []string {
+	var diff []string
+
+	oldValue := reflect.ValueOf(*old)
+	newValue := reflect.ValueOf(*updated)
+	configType := oldValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		before := oldValue.Field(i).Interface()
+		after := newValue.Field(i).Interface()
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		name := strings.Split(configType.Field(i).Tag.Get("json"), ",")[0]
+		if secretConfigFields[name] {
+			diff = append(diff, fmt.Sprintf("%s: changed", name))
+			continue
+		}
+		beforeJSON, _ := json.Marshal(before)
+		afterJSON, _ := json.Marshal(after)
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", name, beforeJSON, afterJSON))
+	}
+	return diff
+}
+
+// reloadConfig loads the config file again and, if it is valid and differs
+// from the current one, restarts the sinks with it. The flags given to run
+// still override the file. An invalid config is logged and the current one
+// is kept.
+func reloadConfig(live *liveConfig, sinks *sinkSet, args []string, logger *log.Logger) {
+	config, err := loadReloadedConfig()
+	if err != nil {
+		logger.Printf("Config reload failed, keeping the current config: %v", err)
+		return
+	}
+
+	// A salt made up for a run flag is kept, so hashes don't change
+	old := live.get()
+	if err := applyRunArgs(config, args, old.ProjectHashSalt); err != nil {
+		logger.Printf("Config reload failed, keeping the current config: %v", err)
+		return
+	}
+	diff := configDiff(old, config)
+	if len(diff) == 0 {
+		logger.Printf("Config reload: no changes")
+		return
+	}
+
+	sinkConfigs, newSinkList, err := newSinks(config)
+	if err != nil {
+		logger.Printf("Config reload failed, keeping the current config: %v", err)
+		return
+	}
+
+	logger.Printf("Config reloaded:")
+	for _, line := range diff {
+		logger.Printf("  %s", line)
+	}
+	if config.MetricsAddr != old.MetricsAddr {
+		logger.Printf("  (metricsAddr takes effect after a restart)")
+	}
+	for _, sinkConfig := range sinkConfigs {
+		logger.Printf("  Sink: %s (%s, every %d seconds)", sinkConfig.Name, sinkConfig.Type, sinkConfig.IntervalSeconds)
+	}
+
+	live.set(config)
+	sinks.restart(config, sinkConfigs, newSinkList)
+}
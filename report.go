@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ReportOptions holds the flags of the report command
+type ReportOptions struct {
+	GroupBy  string
+	Since    string
+	Until    string
+	ShowCost bool
+	Format   string
+}
+
+// ReportRow is one line of a report
+type ReportRow struct {
+	Key string `json:"key"`
+	TokenTotals
+}
+
+// Report is the JSON document printed by report --json
+type Report struct {
+	GroupBy string      `json:"groupBy"`
+	Since   string      `json:"since,omitempty"`
+	Until   string      `json:"until,omitempty"`
+	Rows    []ReportRow `json:"rows"`
+	Total   TokenTotals `json:"total"`
+}
+
+var reportGroupings = []string{"day", "week", "month", "model", "project"}
+
+func parseReportArgs(args []string) (*ReportOptions, error) {
+	options := &ReportOptions{GroupBy: "day", Format: "table"}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--by":
+			if i+1 < len(args) {
+				options.GroupBy = args[i+1]
+				i++
+			}
+		case "--since":
+			if i+1 < len(args) {
+				options.Since = args[i+1]
+				i++
+			}
+		case "--until":
+			if i+1 < len(args) {
+				options.Until = args[i+1]
+				i++
+			}
+		case "--cost":
+			options.ShowCost = true
+		case "--json":
+			options.Format = "json"
+		case "--csv":
+			options.Format = "csv"
+		default:
+			return nil, fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	if !containsString(reportGroupings, options.GroupBy) {
+		return nil, fmt.Errorf("--by must be one of %s", strings.Join(reportGroupings, ", "))
+	}
+
+	for _, date := range []string{options.Since, options.Until} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+
+	return options, nil
+}
+
+// handleReport prints usage grouped by period, model or project
+func handleReport() {
+	options, err := parseReportArgs(os.Args[2:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	config := loadConfigOrDefault()
+	if options.Since != "" {
+		config = widenWindow(config, options.Since)
+	}
+
+	usageData, err := collectUsageData(config)
+	if err != nil {
+		fmt.Printf("Error collecting data: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := buildReport(usageData, options)
+
+	switch options.Format {
+	case "json":
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error marshaling JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	case "csv":
+		if err := writeReportCSV(report, options); err != nil {
+			fmt.Printf("Error writing CSV: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		writeReportTable(report, options)
+	}
+}
+
+// widenWindow returns config with the collection window reaching back to
+// since, if it starts earlier than lookbackDays; otherwise config itself.
+// Days before the usual window come from the usage history and from
+// transcripts that still exist.
+func widenWindow(config *Config, since string) *Config {
+	loc, err := config.getLocation()
+	if err != nil {
+		return config // Reported when collecting
+	}
+	sinceDay, err := time.ParseInLocation("2006-01-02", since, loc)
+	if err != nil || !sinceDay.Before(config.getWindowStart(loc)) {
+		return config
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	// Rounded, since a DST change makes a day 23 or 25 hours long
+	widened := *config
+	widened.LookbackDays = int(math.Round(today.Sub(sinceDay).Hours()/24)) + 1
+	return &widened
+}
+
+// buildReport filters the days to the requested range and groups them
+func buildReport(usageData *UsageData, options *ReportOptions) *Report {
+	report := &Report{GroupBy: options.GroupBy, Since: options.Since, Until: options.Until, Rows: []ReportRow{}}
+	rows := make(map[string]*TokenTotals)
+
+	for _, day := range usageData.Daily {
+		if options.Since != "" && day.Date < options.Since {
+			continue
+		}
+		if options.Until != "" && day.Date > options.Until {
+			continue
+		}
+
+		report.Total.merge(day.TokenTotals)
+
+		switch options.GroupBy {
+		case "model":
+			for _, model := range day.Models {
+				reportRow(rows, model.Model).merge(model.TokenTotals)
+			}
+		case "project":
+			for _, project := range day.Projects {
+				reportRow(rows, project.Project).merge(project.TokenTotals)
+			}
+		default:
+			reportRow(rows, periodKey(day.Date, options.GroupBy)).merge(day.TokenTotals)
+		}
+	}
+
+	for key, totals := range rows {
+		report.Rows = append(report.Rows, ReportRow{Key: key, TokenTotals: *totals})
+	}
+
+	// Periods read best in time order, models and projects by usage
+	switch options.GroupBy {
+	case "model", "project":
+		sort.Slice(report.Rows, func(i, j int) bool {
+			if report.Rows[i].TotalTokens != report.Rows[j].TotalTokens {
+				return report.Rows[i].TotalTokens > report.Rows[j].TotalTokens
+			}
+			return report.Rows[i].Key < report.Rows[j].Key
+		})
+	default:
+		sort.Slice(report.Rows, func(i, j int) bool {
+			return report.Rows[i].Key < report.Rows[j].Key
+		})
+	}
+
+	return report
+}
+
+func reportRow(rows map[string]*TokenTotals, key string) *TokenTotals {
+	if rows[key] == nil {
+		rows[key] = &TokenTotals{}
+	}
+	return rows[key]
+}
+
+// periodKey maps a YYYY-MM-DD date to its day, ISO week or month
+func periodKey(date string, groupBy string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+
+	switch groupBy {
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case "month":
+		return t.Format("2006-01")
+	}
+	return date
+}
+
+func reportHeader(options *ReportOptions) []string {
+	header := []string{strings.ToUpper(options.GroupBy[:1]) + options.GroupBy[1:],
+		"Input", "Output", "Cache Write", "Cache Read", "Total", "Requests"}
+	if options.ShowCost {
+		header = append(header, "Cost (USD)")
+	}
+	return header
+}
+
+func writeReportTable(report *Report, options *ReportOptions) {
+	if len(report.Rows) == 0 {
+		fmt.Println("No usage data in the selected range")
+		return
+	}
+
+	header := reportHeader(options)
+
+	// Numbers are right-aligned; pad the key column so it stays on the left
+	keyWidth := len("Total")
+	for _, row := range report.Rows {
+		if len(row.Key) > keyWidth {
+			keyWidth = len(row.Key)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	writeLine := func(cells []string) {
+		cells[0] = fmt.Sprintf("%-*s", keyWidth, cells[0])
+		fmt.Fprintln(w, strings.Join(cells, "\t")+"\t")
+	}
+	formatRow := func(key string, totals TokenTotals) []string {
+		cells := []string{key,
+			formatCount(totals.TotalInputTokens),
+			formatCount(totals.TotalOutputTokens),
+			formatCount(totals.TotalCacheWriteTokens),
+			formatCount(totals.TotalCacheReadTokens),
+			formatCount(totals.TotalTokens),
+			formatCount(int64(totals.RequestCount))}
+		if options.ShowCost {
+			cells = append(cells, fmt.Sprintf("$%.2f", totals.EstimatedCostUSD))
+		}
+		return cells
+	}
+
+	writeLine(header)
+	separator := make([]string, len(header))
+	for i, title := range header {
+		separator[i] = strings.Repeat("-", len(title))
+	}
+	separator[0] = strings.Repeat("-", keyWidth)
+	writeLine(separator)
+
+	for _, row := range report.Rows {
+		writeLine(formatRow(row.Key, row.TokenTotals))
+	}
+
+	writeLine(separator)
+	writeLine(formatRow("Total", report.Total))
+
+	w.Flush()
+}
+
+func writeReportCSV(report *Report, options *ReportOptions) error {
+	w := csv.NewWriter(os.Stdout)
+
+	formatRow := func(key string, totals TokenTotals) []string {
+		cells := []string{key,
+			strconv.FormatInt(totals.TotalInputTokens, 10),
+			strconv.FormatInt(totals.TotalOutputTokens, 10),
+			strconv.FormatInt(totals.TotalCacheWriteTokens, 10),
+			strconv.FormatInt(totals.TotalCacheReadTokens, 10),
+			strconv.FormatInt(totals.TotalTokens, 10),
+			strconv.Itoa(totals.RequestCount)}
+		if options.ShowCost {
+			cells = append(cells, strconv.FormatFloat(totals.EstimatedCostUSD, 'f', 6, 64))
+		}
+		return cells
+	}
+
+	w.Write(reportHeader(options))
+	for _, row := range report.Rows {
+		w.Write(formatRow(row.Key, row.TokenTotals))
+	}
+	w.Write(formatRow("Total", report.Total))
+
+	w.Flush()
+	return w.Error()
+}
+
+// formatCount renders n with thousands separators
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+
+	var b strings.Builder
+	for i, digit := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
@@ -0,0 +1,319 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const systemdUnitName = "claude-monitor.service"
+
+func getXDGConfigHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".config")
+}
+
+func getSystemdUnitPath() string {
+	return filepath.Join(getXDGConfigHome(), "systemd", "user", systemdUnitName)
+}
+
+func getAutostartPath() string {
+	return filepath.Join(getXDGConfigHome(), "autostart", "claude-monitor.desktop")
+}
+
+func getExecutablePath() (string, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(execPath)
+}
+
+func copyBinaryToConfigDir() (string, error) {
+	srcPath, err := getExecutablePath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	// Ensure config directory exists
+	if err := os.MkdirAll(getConfigDir(), 0700); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	dstPath := getInstalledBinaryPath()
+
+	// Replacing the binary of a running service fails with ETXTBSY, so write
+	// to a temporary file and rename it over the old one
+	tmpPath := dstPath + ".new"
+
+	// Open source file
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source binary: %w", err)
+	}
+	defer srcFile.Close()
+
+	// Create destination file
+	dstFile, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination binary: %w", err)
+	}
+
+	// Copy content
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to copy binary: %w", err)
+	}
+	dstFile.Close()
+
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to replace binary: %w", err)
+	}
+
+	return dstPath, nil
+}
+
+// hasSystemdUserSession reports whether a systemd user manager is reachable.
+// Containers, WSL1 and minimal window managers often run without one.
+func hasSystemdUserSession() bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
+	return exec.Command("systemctl", "--user", "show-environment").Run() == nil
+}
+
+func installService(_ *Config) error {
+	// Stop existing service if running
+	if isServiceInstalled() {
+		fmt.Println("Stopping existing service...")
+		stopService()
+	}
+
+	// Copy binary to config directory
+	installedPath, err := copyBinaryToConfigDir()
+	if err != nil {
+		return fmt.Errorf("failed to copy binary: %w", err)
+	}
+	fmt.Printf("Binary copied to: %s\n", installedPath)
+
+	if hasSystemdUserSession() {
+		return installSystemdService(installedPath)
+	}
+
+	fmt.Println("No systemd user session found, using XDG autostart instead")
+	return installAutostartEntry(installedPath)
+}
+
+func installSystemdService(installedPath string) error {
+	unitPath := getSystemdUnitPath()
+
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return fmt.Errorf("failed to create systemd user directory: %w", err)
+	}
+
+	unitContent := fmt.Sprintf(`[Unit]
+Description=Claude Code Usage Monitor
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart="%s" run
+Restart=always
+RestartSec=10
+StandardOutput=append:%s
+StandardError=append:%s
+
+[Install]
+WantedBy=default.target
+`, installedPath, getLogPath(), getLogPath())
+
+	if err := os.WriteFile(unitPath, []byte(unitContent), 0644); err != nil {
+		return fmt.Errorf("failed to write systemd unit: %w", err)
+	}
+
+	if output, err := exec.Command("systemctl", "--user", "daemon-reload").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reload systemd: %s - %w", string(output), err)
+	}
+
+	// Enable and start the service
+	fmt.Println("Starting service...")
+	cmd := exec.Command("systemctl", "--user", "enable", "--now", systemdUnitName)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to enable systemd unit: %s - %w", string(output), err)
+	}
+
+	return nil
+}
+
+func installAutostartEntry(installedPath string) error {
+	desktopPath := getAutostartPath()
+
+	if err := os.MkdirAll(filepath.Dir(desktopPath), 0755); err != nil {
+		return fmt.Errorf("failed to create autostart directory: %w", err)
+	}
+
+	// Desktop entries don't redirect output, so let the shell append to the log file
+	desktopContent := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=Claude Monitor
+Comment=Claude Code Usage Monitor
+Exec=sh -c '"%s" run >> "%s" 2>&1'
+Terminal=false
+NoDisplay=true
+X-GNOME-Autostart-enabled=true
+`, installedPath, getLogPath())
+
+	if err := os.WriteFile(desktopPath, []byte(desktopContent), 0644); err != nil {
+		return fmt.Errorf("failed to write autostart entry: %w", err)
+	}
+
+	// Autostart entries only run at the next login, so start it now as well
+	fmt.Println("Starting service...")
+	return startDetached(installedPath)
+}
+
+// startDetached launches the monitor in its own session with output appended to the log file
+func startDetached(installedPath string) error {
+	logFile, err := os.OpenFile(getLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(installedPath, "run")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start monitor: %w", err)
+	}
+
+	return cmd.Process.Release()
+}
+
+// stopService stops whichever backend is installed, ignoring errors
+func stopService() {
+	if _, err := os.Stat(getSystemdUnitPath()); err == nil {
+		exec.Command("systemctl", "--user", "stop", systemdUnitName).Run()
+	}
+	if _, err := os.Stat(getAutostartPath()); err == nil {
+		exec.Command("pkill", "-f", getInstalledBinaryPath()+" run").Run()
+	}
+}
+
+func uninstallService() error {
+	unitPath := getSystemdUnitPath()
+	desktopPath := getAutostartPath()
+
+	_, unitErr := os.Stat(unitPath)
+	_, desktopErr := os.Stat(desktopPath)
+	if os.IsNotExist(unitErr) && os.IsNotExist(desktopErr) {
+		return fmt.Errorf("service is not installed")
+	}
+
+	if unitErr == nil {
+		// Disable and stop
+		cmd := exec.Command("systemctl", "--user", "disable", "--now", systemdUnitName)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			// Continue even if disable fails
+			fmt.Printf("Warning: disable returned: %s\n", string(output))
+		}
+
+		// Remove unit file
+		if err := os.Remove(unitPath); err != nil {
+			return fmt.Errorf("failed to remove systemd unit: %w", err)
+		}
+
+		exec.Command("systemctl", "--user", "daemon-reload").Run()
+	}
+
+	if desktopErr == nil {
+		exec.Command("pkill", "-f", getInstalledBinaryPath()+" run").Run()
+
+		// Remove autostart entry
+		if err := os.Remove(desktopPath); err != nil {
+			return fmt.Errorf("failed to remove autostart entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func isServiceRunning() bool {
+	cmd := exec.Command("pgrep", "-f", getInstalledBinaryPath()+" run")
+	output, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	return len(strings.TrimSpace(string(output))) > 0
+}
+
+func getServiceStatus() string {
+	if _, err := os.Stat(getSystemdUnitPath()); err == nil {
+		return getSystemdServiceStatus()
+	}
+
+	if _, err := os.Stat(getAutostartPath()); err == nil {
+		output, err := exec.Command("pgrep", "-f", getInstalledBinaryPath()+" run").Output()
+		if err != nil {
+			return "Installed (XDG autostart, not running)"
+		}
+		pid := strings.Fields(string(output))[0]
+		return fmt.Sprintf("Running (PID: %s, XDG autostart)", pid)
+	}
+
+	return "Not installed"
+}
+
+func getSystemdServiceStatus() string {
+	cmd := exec.Command("systemctl", "--user", "show", systemdUnitName,
+		"--property=ActiveState,SubState,MainPID")
+	output, err := cmd.Output()
+	if err != nil {
+		return "Installed (systemd user session unavailable)"
+	}
+
+	// systemctl show prints one Key=Value pair per line:
+	// ActiveState=active
+	// SubState=running
+	// MainPID=12345
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			props[parts[0]] = parts[1]
+		}
+	}
+
+	activeState := props["ActiveState"]
+	subState := props["SubState"]
+	pid := props["MainPID"]
+
+	if activeState == "active" && pid != "" && pid != "0" {
+		return fmt.Sprintf("Running (PID: %s)", pid)
+	}
+	if activeState == "" {
+		return "Installed but not running"
+	}
+
+	return fmt.Sprintf("Installed but not running (%s/%s)", activeState, subState)
+}
+
+func isServiceInstalled() bool {
+	if _, err := os.Stat(getSystemdUnitPath()); err == nil {
+		return true
+	}
+	_, err := os.Stat(getAutostartPath())
+	return err == nil
+}
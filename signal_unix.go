@@ -0,0 +1,19 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySyncSignal delivers SIGUSR1, which asks the daemon to upload now
+func notifySyncSignal(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
+
+// notifyReloadSignal delivers SIGHUP, which asks the daemon to reload its config
+func notifyReloadSignal(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
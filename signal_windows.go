@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifySyncSignal does nothing: Windows has no SIGUSR1, use 'claude-monitor sync'
+func notifySyncSignal(c chan<- os.Signal) {}
+
+// notifyReloadSignal does nothing: Windows has no SIGHUP; config file
+// changes are still picked up
+func notifyReloadSignal(c chan<- os.Signal) {}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sink delivers collected usage data to one destination. Each sink runs on
+// its own schedule, so a slow or failing sink doesn't hold up the others.
+// cancel is closed when the daemon stops or reloads; a sink waiting to retry
+// gives up then.
+type Sink interface {
+	Name() string
+	Send(usageData *UsageData, cancel <-chan struct{}) (*UploadResult, error)
+}
+
+// SinkConfig describes one entry of Config.Sinks
+type SinkConfig struct {
+	Name string `json:"name,omitempty"`
+
+	// "http" (the usage server), "file" or "otlp"
+	Type string `json:"type"`
+
+	// Defaults to the top-level intervalSeconds
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+
+	// http: default to the top-level serverUrl, apiToken and signingSecret
+	ServerURL     string `json:"serverUrl,omitempty"`
+	APIToken      string `json:"apiToken,omitempty"`
+	SigningSecret string `json:"signingSecret,omitempty"`
+
+	// file: where the latest snapshot is written
+	Path string `json:"path,omitempty"`
+
+	// otlp: serverUrl is the collector's OTLP/HTTP endpoint; headers are
+	// added to every export (e.g. for authentication)
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// defaultSinkName is used for the implicit sink when Config.Sinks is empty
+const defaultSinkName = "server"
+
+// getSinkConfigs returns the configured sinks with names and intervals filled
+// in. Without explicit sinks, usage goes to the top-level server only.
+func getSinkConfigs(config *Config) ([]SinkConfig, error) {
+	sinkConfigs := config.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = []SinkConfig{{Name: defaultSinkName, Type: "http"}}
+	}
+
+	resolved := make([]SinkConfig, 0, len(sinkConfigs))
+	seen := make(map[string]bool)
+	for i, sinkConfig := range sinkConfigs {
+		if sinkConfig.Name == "" {
+			sinkConfig.Name = fmt.Sprintf("%s-%d", sinkConfig.Type, i+1)
+		}
+		if strings.ContainsAny(sinkConfig.Name, `/\`) || sinkConfig.Name == "." || sinkConfig.Name == ".." {
+			return nil, fmt.Errorf("invalid sink name %q", sinkConfig.Name)
+		}
+		if seen[sinkConfig.Name] {
+			return nil, fmt.Errorf("duplicate sink name %q", sinkConfig.Name)
+		}
+		seen[sinkConfig.Name] = true
+
+		if sinkConfig.IntervalSeconds <= 0 {
+			sinkConfig.IntervalSeconds = config.IntervalSeconds
+		}
+
+		resolved = append(resolved, sinkConfig)
+	}
+
+	return resolved, nil
+}
+
+// newSink creates the sink described by sinkConfig
+func newSink(config *Config, sinkConfig SinkConfig) (Sink, error) {
+	switch sinkConfig.Type {
+	case "http":
+		return newHTTPSink(config, sinkConfig)
+	case "otlp":
+		return newOTLPSink(config, sinkConfig)
+	case "file":
+		if sinkConfig.Path == "" {
+			return nil, fmt.Errorf("sink %q: file sink requires a path", sinkConfig.Name)
+		}
+		return &FileSink{name: sinkConfig.Name, path: sinkConfig.Path, email: config.Email}, nil
+	default:
+		return nil, fmt.Errorf("sink %q: unknown type %q", sinkConfig.Name, sinkConfig.Type)
+	}
+}
+
+// FileSink writes the latest usage snapshot to a local JSON file
+type FileSink struct {
+	name  string
+	path  string
+	email string
+}
+
+// FileSnapshot is the document written by FileSink
+type FileSnapshot struct {
+	Hostname  string     `json:"hostname"`
+	Timestamp int64      `json:"timestamp"`
+	UserEmail string     `json:"userEmail"`
+	Usage     *UsageData `json:"usage"`
+}
+
+func (s *FileSink) Name() string {
+	return s.name
+}
+
+func (s *FileSink) Send(usageData *UsageData, cancel <-chan struct{}) (*UploadResult, error) {
+	hostname, _ := os.Hostname()
+	data, err := json.MarshalIndent(&FileSnapshot{
+		Hostname:  hostname,
+		Timestamp: time.Now().Unix(),
+		UserEmail: s.email,
+		Usage:     usageData,
+	}, "", "  ")
+	if err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+
+	// Write atomically so readers never see a partial file
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+
+	return &UploadResult{
+		Success: true,
+		Message: fmt.Sprintf("Wrote %d days of data to %s", len(usageData.Daily), s.path),
+	}, nil
+}
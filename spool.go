@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSpoolMaxFiles = 200
+	defaultSpoolMaxBytes = 50 * 1024 * 1024
+)
+
+// SpoolEntry is a payload that could not be delivered, kept on disk so it
+// survives restarts and is retried in order on later cycles
+type SpoolEntry struct {
+	Hostname  string          `json:"hostname"`
+	Timestamp int64           `json:"timestamp"`
+	DayCount  int             `json:"dayCount"`
+	Data      json.RawMessage `json:"data"`
+
+	// Set in the "changed" upload mode, to record the payload once delivered
+	Ledger *LedgerUpdate `json:"ledger,omitempty"`
+}
+
+// Spool is the on-disk queue of one sink
+type Spool struct {
+	dir      string
+	maxFiles int
+	maxBytes int64
+}
+
+func getSpoolDir() string {
+	return filepath.Join(getConfigDir(), "spool")
+}
+
+// newSpool returns the spool of the named sink
+func newSpool(config *Config, sinkName string) *Spool {
+	spool := &Spool{
+		dir:      filepath.Join(getSpoolDir(), sinkName),
+		maxFiles: config.SpoolMaxFiles,
+		maxBytes: config.SpoolMaxBytes,
+	}
+	if spool.maxFiles <= 0 {
+		spool.maxFiles = defaultSpoolMaxFiles
+	}
+	if spool.maxBytes <= 0 {
+		spool.maxBytes = defaultSpoolMaxBytes
+	}
+	return spool
+}
+
+// add writes the entry to the spool and enforces the size limits
+func (s *Spool) add(entry *SpoolEntry) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Zero-padded nanosecond timestamps keep lexical order equal to creation order
+	name := fmt.Sprintf("%020d.json", time.Now().UnixNano())
+	tmpPath := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	return s.trim()
+}
+
+// replace writes the entry and removes every older one
+func (s *Spool) replace(entry *SpoolEntry) error {
+	older, err := s.list()
+	if err != nil {
+		return err
+	}
+	if err := s.add(entry); err != nil {
+		return err
+	}
+	for _, path := range older {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns spooled file paths, oldest first
+func (s *Spool) list() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		paths = append(paths, filepath.Join(s.dir, entry.Name()))
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// read loads a spooled payload
+func (s *Spool) read(path string) (*SpoolEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry SpoolEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// trim drops the oldest payloads until the spool fits its limits
+func (s *Spool) trim() error {
+	paths, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	sizes := make([]int64, len(paths))
+	var totalBytes int64
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			sizes[i] = info.Size()
+			totalBytes += sizes[i]
+		}
+	}
+
+	for i := 0; i < len(paths) && (len(paths)-i > s.maxFiles || totalBytes > s.maxBytes); i++ {
+		if err := os.Remove(paths[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		totalBytes -= sizes[i]
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DaemonState tracks what the running daemon has done, for the metrics
+// endpoint and the control socket. All methods are safe for concurrent use.
+type DaemonState struct {
+	mu sync.Mutex
+
+	startTime time.Time
+	sinks     map[string]*SinkState
+
+	lastUsage              *UsageData
+	lastCollectionTime     time.Time
+	lastCollectionDuration time.Duration
+	collectionCount        int
+
+	// Summed over all collections, since each reads only appended lines
+	diagnostics Diagnostics
+}
+
+// SinkState holds the upload history of one sink
+type SinkState struct {
+	Name        string    `json:"name"`
+	Uploads     int       `json:"uploads"`
+	Failures    int       `json:"failures"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastMessage string    `json:"lastMessage,omitempty"`
+	LastFailure time.Time `json:"lastFailure"`
+	LastError   string    `json:"lastError,omitempty"`
+
+	// When the next scheduled upload is due
+	NextRun time.Time `json:"nextRun"`
+}
+
+func newDaemonState() *DaemonState {
+	return &DaemonState{
+		startTime: time.Now(),
+		sinks:     make(map[string]*SinkState),
+	}
+}
+
+func (s *DaemonState) sink(name string) *SinkState {
+	sinkState := s.sinks[name]
+	if sinkState == nil {
+		sinkState = &SinkState{Name: name}
+		s.sinks[name] = sinkState
+	}
+	return sinkState
+}
+
+// recordCollection stores the result of a collection run
+func (s *DaemonState) recordCollection(usageData *UsageData, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastUsage = usageData
+	s.lastCollectionTime = time.Now()
+	s.lastCollectionDuration = duration
+	s.collectionCount++
+	s.diagnostics.merge(usageData.diagnostics)
+	s.diagnostics.Duration = usageData.diagnostics.Duration
+}
+
+// recordUpload stores the outcome of one upload attempt to a sink
+func (s *DaemonState) recordUpload(name string, result *UploadResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sinkState := s.sink(name)
+	sinkState.Uploads++
+	if err != nil {
+		sinkState.Failures++
+		sinkState.LastFailure = time.Now()
+		sinkState.LastError = failureMessage(err, result)
+		return
+	}
+	sinkState.LastSuccess = time.Now()
+	if result != nil {
+		sinkState.LastMessage = result.Message
+	}
+}
+
+// addSink registers a sink before its first upload, so it is listed while
+// that upload is still running
+func (s *DaemonState) addSink(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sink(name)
+}
+
+// recordNextRun stores when the next scheduled upload to a sink is due
+func (s *DaemonState) recordNextRun(name string, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sink(name).NextRun = next
+}
+
+// snapshotSinks returns copies of all sink states, sorted by name
+func (s *DaemonState) snapshotSinks() []SinkState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sinks := make([]SinkState, 0, len(s.sinks))
+	for _, sinkState := range s.sinks {
+		sinks = append(sinks, *sinkState)
+	}
+	sort.Slice(sinks, func(i, j int) bool {
+		return sinks[i].Name < sinks[j].Name
+	})
+	return sinks
+}
+
+// totalDiagnostics returns the diagnostics of all collections so far,
+// with the duration of the last one
+func (s *DaemonState) totalDiagnostics() Diagnostics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	diagnostics := s.diagnostics
+	diagnostics.Skipped = make(map[string]int64, len(s.diagnostics.Skipped))
+	for reason, count := range s.diagnostics.Skipped {
+		diagnostics.Skipped[reason] = count
+	}
+	return diagnostics
+}
+
+// lastCollection returns the most recent usage data and how long collecting it took
+func (s *DaemonState) lastCollection() (*UsageData, time.Time, time.Duration, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastUsage, s.lastCollectionTime, s.lastCollectionDuration, s.collectionCount
+}
+
+// status returns a snapshot for the control socket
+func (s *DaemonState) status() *DaemonStatus {
+	sinks := s.snapshotSinks()
+	usageData, collectionTime, _, collectionCount := s.lastCollection()
+
+	status := &DaemonStatus{
+		PID:       os.Getpid(),
+		Version:   version,
+		StartTime: s.startTime,
+		Sinks:     sinks,
+	}
+	if usageData != nil {
+		status.LastCollection = &CollectionStatus{
+			Time:        collectionTime,
+			Count:       collectionCount,
+			Days:        len(usageData.Daily),
+			Diagnostics: usageData.diagnostics,
+
+			DailyCostUSD: dailyCosts(usageData.Daily),
+		}
+	}
+	return status
+}
+
+// dailyCosts returns the estimated cost of each day by date
+func dailyCosts(daily []DailyStats) map[string]float64 {
+	costs := make(map[string]float64, len(daily))
+	for _, day := range daily {
+		costs[day.Date] += day.EstimatedCostUSD
+	}
+	return costs
+}
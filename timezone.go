@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	// Embedded zone database so IANA names also work on Windows
+	_ "time/tzdata"
+)
+
+// getLocation returns the zone usage is cut into days in: the configured
+// IANA zone, or the machine's local zone by default
+func (c *Config) getLocation() (*time.Location, error) {
+	if c.Timezone == "" || c.Timezone == "Local" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", c.Timezone, err)
+	}
+	return loc, nil
+}
+
+// timezoneName returns a name for loc the server can interpret: the IANA
+// name when known, otherwise the current UTC offset such as "+09:00"
+func timezoneName(loc *time.Location) string {
+	if loc != time.Local {
+		return loc.String()
+	}
+	if name := localZoneName(); name != "" {
+		return name
+	}
+	return time.Now().In(loc).Format("-07:00")
+}
+
+// localZoneName looks up the IANA name of the local zone from TZ or the
+// /etc/localtime symlink; it returns "" if neither names one (e.g. on Windows)
+func localZoneName() string {
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		tz = strings.TrimPrefix(tz, ":")
+		if tz == "" {
+			return "UTC"
+		}
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+
+	target, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	if i := strings.LastIndex(target, "zoneinfo/"); i >= 0 {
+		return target[i+len("zoneinfo/"):]
+	}
+	return ""
+}
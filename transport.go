@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// newHTTPClient builds the upload client from the TLS and proxy settings in config
+func newHTTPClient(config *Config) (*http.Client, error) {
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := buildProxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}, nil
+}
+
+// buildTLSConfig loads the custom CA bundle and client certificate, if configured
+func buildTLSConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if config.CACertFile != "" {
+		pem, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate file: %w", err)
+		}
+
+		// Trust the system roots as well, so a proxy or redirect to a public
+		// host keeps working
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA certificate file %s", config.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCertFile != "" || config.ClientKeyFile != "" {
+		if config.ClientCertFile == "" || config.ClientKeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key must be configured together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// buildProxyFunc returns the proxy selector for the transport. Without an
+// explicit proxy the standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY variables apply.
+func buildProxyFunc(config *Config) (func(*http.Request) (*url.URL, error), error) {
+	if config.HTTPProxy == "" && config.HTTPSProxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	httpProxy, err := parseProxyURL(config.HTTPProxy)
+	if err != nil {
+		return nil, err
+	}
+	httpsProxy, err := parseProxyURL(config.HTTPSProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	noProxy := splitNoProxy(config.NoProxy)
+
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL, noProxy) {
+			return nil, nil
+		}
+		if req.URL.Scheme == "https" {
+			return httpsProxy, nil
+		}
+		return httpProxy, nil
+	}, nil
+}
+
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", rawURL, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", rawURL)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", rawURL)
+	}
+
+	return proxyURL, nil
+}
+
+func splitNoProxy(noProxy string) []string {
+	var entries []string
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// bypassProxy reports whether the URL matches a no-proxy entry. Entries are
+// "*", a domain (matching itself and subdomains, with or without a leading
+// dot), an IP address, a CIDR range, or any of these with ":port".
+func bypassProxy(target *url.URL, noProxy []string) bool {
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if port == "" {
+		if target.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	ip := net.ParseIP(host)
+
+	for _, entry := range noProxy {
+		if entry == "*" {
+			return true
+		}
+
+		// Strip an optional port, which must then match too
+		entryHost := entry
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entryHost = h
+		}
+
+		if _, network, err := net.ParseCIDR(entryHost); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		domain := strings.TrimPrefix(entryHost, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateTransportConfig checks that certificate files and proxy URLs are
+// usable, so problems surface at install time rather than on every upload
+func validateTransportConfig(config *Config) error {
+	for _, file := range []struct{ name, path string }{
+		{"CA certificate", config.CACertFile},
+		{"client certificate", config.ClientCertFile},
+		{"client key", config.ClientKeyFile},
+	} {
+		if file.path == "" {
+			continue
+		}
+		f, err := os.Open(file.path)
+		if err != nil {
+			return fmt.Errorf("%s file is not readable: %w", file.name, err)
+		}
+		f.Close()
+	}
+
+	_, err := newHTTPClient(config)
+	return err
+}
+
+// transportWarnings lists settings that are valid but likely a mistake, for
+// install and doctor to show
+func transportWarnings(config *Config) []string {
+	var warnings []string
+	if strings.HasPrefix(config.ServerURL, "http://") &&
+		(config.CACertFile != "" || config.ClientCertFile != "") {
+		warnings = append(warnings, "TLS options are set but the server URL uses plain http://")
+	}
+	return warnings
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBypassProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		noProxy string
+		want    bool
+	}{
+		{"empty list", "http://usage.internal", "", false},
+		{"wildcard", "https://usage.example.com", "*", true},
+		{"exact host", "http://usage.internal:3498", "usage.internal", true},
+		{"other host", "http://usage.internal", "metrics.internal", false},
+		{"host case", "http://Usage.Internal", "usage.internal", true},
+		{"domain matches subdomain", "https://usage.corp.example.com", "corp.example.com", true},
+		{"dotted domain matches subdomain", "https://usage.corp.example.com", ".corp.example.com", true},
+		{"dotted domain matches itself", "https://corp.example.com", ".corp.example.com", true},
+		{"suffix is not a subdomain", "https://evilcorp.example.com", "corp.example.com", false},
+		{"ip", "http://10.12.200.99:3498", "10.12.200.99", true},
+		{"other ip", "http://10.12.200.98:3498", "10.12.200.99", false},
+		{"cidr", "http://10.12.200.99:3498", "10.12.0.0/16", true},
+		{"outside cidr", "http://10.13.0.1", "10.12.0.0/16", false},
+		{"cidr doesn't match a name", "http://usage.internal", "10.0.0.0/8", false},
+		{"ipv6", "http://[fd00::1]:3498", "fd00::/8", true},
+		{"port matches", "http://usage.internal:3498", "usage.internal:3498", true},
+		{"port differs", "http://usage.internal:8080", "usage.internal:3498", false},
+		{"default https port", "https://usage.internal", "usage.internal:443", true},
+		{"default http port", "http://usage.internal", "usage.internal:443", false},
+		{"ip with port", "http://10.12.200.99:3498", "10.12.200.99:3498", true},
+		{"list", "https://usage.example.com", "localhost, 127.0.0.1,.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bypassProxy(target, splitNoProxy(tt.noProxy)); got != tt.want {
+				t.Errorf("bypassProxy(%s, %q) = %v, want %v", tt.url, tt.noProxy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not-a-cert.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"none", Config{}, ""},
+		{"missing CA file", Config{CACertFile: filepath.Join(dir, "missing.pem")}, "failed to read CA certificate file"},
+		{"CA file without PEM", Config{CACertFile: notPEM}, "no PEM certificates found"},
+		{"certificate without key", Config{ClientCertFile: notPEM}, "must be configured together"},
+		{"bad key pair", Config{ClientCertFile: notPEM, ClientKeyFile: notPEM}, "failed to load client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildTLSConfig(&tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("buildTLSConfig: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("buildTLSConfig error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestBuildTLSConfigCA checks that a server whose certificate is in the CA
+// file is trusted
+func TestBuildTLSConfigCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := newHTTPClient(&Config{CACertFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request to a server signed by the CA file: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTransportWarnings(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   int
+	}{
+		{"plain http", Config{ServerURL: "http://usage.internal"}, 0},
+		{"https with CA", Config{ServerURL: "https://usage.internal", CACertFile: "ca.pem"}, 0},
+		{"http with CA", Config{ServerURL: "http://usage.internal", CACertFile: "ca.pem"}, 1},
+		{"http with client certificate", Config{ServerURL: "http://usage.internal", ClientCertFile: "client.pem"}, 1},
+	}
+
+	for _, tt := range tests {
+		if got := transportWarnings(&tt.config); len(got) != tt.want {
+			t.Errorf("%s: warnings %v, want %d", tt.name, got, tt.want)
+		}
+	}
+}
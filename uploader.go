@@ -5,35 +5,329 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 )
 
+const (
+	uploadMaxAttempts = 4
+	uploadBaseBackoff = 2 * time.Second
+	uploadMaxBackoff  = time.Minute
+
+	// Upper bound on a server-provided Retry-After so one response can't stall the loop
+	uploadMaxRetryAfter = 5 * time.Minute
+
+	// Upper bound on the total wait between attempts of one upload; what
+	// can't be delivered within it is spooled for the next cycle
+	uploadMaxRetryWait = 5 * time.Minute
+)
+
 type UploadResult struct {
 	Success    bool
 	StatusCode int
 	Message    string
+
+	// Delay requested by the server via Retry-After, if any
+	RetryAfter time.Duration
+}
+
+// HTTPSink uploads usage data as a multipart form to the usage server,
+// retrying transient failures and spooling payloads it couldn't deliver
+type HTTPSink struct {
+	name          string
+	serverURL     string
+	email         string
+	apiToken      string
+	signingSecret string
+	hashProjects  bool
+	projectSalt   string
+	client        *http.Client
+	spool         *Spool
+
+	// Upload only changed days, with a full upload every fullResync
+	changedOnly bool
+	fullResync  time.Duration
 }
 
-func uploadUsageData(config *Config) (*UploadResult, error) {
-	// Collect usage data
-	usageData, err := collectUsageData()
+// newHTTPSink creates an HTTP sink; empty fields in sinkConfig fall back to
+// the top-level server settings
+func newHTTPSink(config *Config, sinkConfig SinkConfig) (*HTTPSink, error) {
+	client, err := newHTTPClient(config)
 	if err != nil {
-		return &UploadResult{Success: false, Message: err.Error()}, err
+		return nil, err
+	}
+
+	sink := &HTTPSink{
+		name:          sinkConfig.Name,
+		serverURL:     sinkConfig.ServerURL,
+		email:         config.Email,
+		apiToken:      sinkConfig.APIToken,
+		signingSecret: sinkConfig.SigningSecret,
+		hashProjects:  config.HashProjectPaths,
+		projectSalt:   config.ProjectHashSalt,
+		client:        client,
+		spool:         newSpool(config, sinkConfig.Name),
+		changedOnly:   config.UploadMode == "changed",
+		fullResync:    config.getFullResyncInterval(),
+	}
+	if sink.serverURL == "" {
+		sink.serverURL = config.ServerURL
+	}
+	if sink.apiToken == "" {
+		sink.apiToken = config.getAPIToken()
+	}
+	if sink.signingSecret == "" {
+		sink.signingSecret = config.getSigningSecret()
+	}
+
+	return sink, nil
+}
+
+func (s *HTTPSink) Name() string {
+	return s.name
+}
+
+func (s *HTTPSink) Send(usageData *UsageData, cancel <-chan struct{}) (*UploadResult, error) {
+	var ledger *UploadLedger
+	if s.changedOnly {
+		ledger = loadUploadLedger(s.name)
+	}
+
+	// Deliver payloads that failed earlier first, so the server sees them in
+	// order; the ledger records them, so their days aren't sent again below
+	delivered, err := s.flushSpool(ledger)
+	if err != nil {
+		// Days queued already, with the same contents, aren't queued again
+		payload := usageData
+		if ledger != nil && len(usageData.Daily) > 0 {
+			payload = s.queuedLedger(ledger).changedDays(usageData, s.fullResync)
+		}
+		if len(payload.Daily) > 0 {
+			if entry, buildErr := s.newSpoolEntry(payload); buildErr == nil {
+				s.spoolPayload(payload, entry)
+			}
+		}
+		pending, _ := s.spool.list()
+		return &UploadResult{
+			Success: false,
+			Message: fmt.Sprintf("%v (%d payloads spooled for retry)", err, len(pending)),
+		}, err
 	}
 
 	if len(usageData.Daily) == 0 {
 		return &UploadResult{Success: true, Message: "No data to upload"}, nil
 	}
+	payload := usageData
+	if ledger != nil {
+		payload = ledger.changedDays(usageData, s.fullResync)
+	}
+	if len(payload.Daily) == 0 {
+		return &UploadResult{Success: true, Message: "No changed days to upload"}, nil
+	}
+
+	entry, err := s.newSpoolEntry(payload)
+	if err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+
+	result, err := s.sendWithRetry(entry, cancel)
+	if err != nil {
+		if spoolErr := s.spoolPayload(payload, entry); spoolErr != nil {
+			result.Message = fmt.Sprintf("%s (spooling failed: %v)", result.Message, spoolErr)
+		} else {
+			result.Message += " (spooled for retry)"
+		}
+		return result, err
+	}
+
+	// A ledger that fails to save only means the same days are sent again
+	if ledger != nil {
+		ledger.record(entry.Ledger)
+		ledger.save()
+	}
+
+	if delivered > 0 {
+		result.Message += fmt.Sprintf(" (and %d spooled payloads)", delivered)
+	}
+	return result, nil
+}
+
+// newSpoolEntry serializes the usage data together with its upload metadata
+func (s *HTTPSink) newSpoolEntry(usageData *UsageData) (*SpoolEntry, error) {
+	// Digests are of the data as collected, which the ledger compares with
+	var ledgerUpdate *LedgerUpdate
+	if s.changedOnly {
+		ledgerUpdate = newLedgerUpdate(usageData)
+	}
+
+	if s.hashProjects {
+		usageData = anonymizeProjects(usageData, s.projectSalt)
+	}
 
 	// Convert to JSON
 	jsonData, err := json.Marshal(usageData)
 	if err != nil {
-		return &UploadResult{Success: false, Message: err.Error()}, err
+		return nil, err
 	}
 
+	hostname, _ := os.Hostname()
+	return &SpoolEntry{
+		Hostname:  hostname,
+		Timestamp: time.Now().Unix(),
+		DayCount:  len(usageData.Daily),
+		Data:      jsonData,
+		Ledger:    ledgerUpdate,
+	}, nil
+}
+
+// spoolPayload keeps an undelivered payload for retry. A full payload holds
+// every day of the older ones with newer values, so it replaces them rather
+// than queueing another copy of the whole window each cycle.
+func (s *HTTPSink) spoolPayload(payload *UsageData, entry *SpoolEntry) error {
+	if payload.Partial {
+		return s.spool.add(entry)
+	}
+	return s.spool.replace(entry)
+}
+
+// queuedLedger returns the ledger as it will be once the spooled payloads
+// are delivered
+func (s *HTTPSink) queuedLedger(ledger *UploadLedger) *UploadLedger {
+	queued := ledger.clone()
+	paths, _ := s.spool.list()
+	for _, path := range paths {
+		if entry, err := s.spool.read(path); err == nil && entry.Ledger != nil {
+			queued.record(entry.Ledger)
+		}
+	}
+	return queued
+}
+
+// flushSpool sends spooled payloads oldest first, stopping at the first one
+// that can't be delivered, and records those delivered in ledger, if given.
+// Payloads the server rejects outright are dropped, since retrying them
+// would block the queue forever.
+func (s *HTTPSink) flushSpool(ledger *UploadLedger) (int, error) {
+	paths, err := s.spool.list()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spool: %w", err)
+	}
+
+	delivered := 0
+	for _, path := range paths {
+		entry, err := s.spool.read(path)
+		if err != nil {
+			// Corrupt entry, nothing to retry
+			os.Remove(path)
+			continue
+		}
+
+		result, err := s.sendPayload(entry)
+		if err != nil && isRetryable(result) {
+			return delivered, fmt.Errorf("spooled upload failed: %w", err)
+		}
+
+		os.Remove(path)
+		if err == nil {
+			delivered++
+			if ledger != nil && entry.Ledger != nil {
+				ledger.record(entry.Ledger)
+				ledger.save()
+			}
+		}
+	}
+
+	return delivered, nil
+}
+
+// sendWithRetry sends the payload, retrying transient failures with
+// exponential backoff and jitter, or after the server's Retry-After delay.
+// It gives up early once waiting would exceed uploadMaxRetryWait in total,
+// or when cancel is closed.
+func (s *HTTPSink) sendWithRetry(entry *SpoolEntry, cancel <-chan struct{}) (*UploadResult, error) {
+	var result *UploadResult
+	var err error
+	var waited time.Duration
+
+	for attempt := 0; attempt < uploadMaxAttempts; attempt++ {
+		result, err = s.sendPayload(entry)
+		if err == nil || !isRetryable(result) || attempt == uploadMaxAttempts-1 {
+			break
+		}
+
+		delay := backoffDelay(attempt)
+		if result.RetryAfter > 0 {
+			delay = result.RetryAfter
+		}
+		if waited+delay > uploadMaxRetryWait {
+			break
+		}
+		waited += delay
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-cancel:
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+
+	return result, err
+}
+
+// isRetryable reports whether a failed upload may succeed if tried again
+func isRetryable(result *UploadResult) bool {
+	switch {
+	case result.StatusCode == 0:
+		// Network error, timeout, DNS failure...
+		return true
+	case result.StatusCode == http.StatusRequestTimeout,
+		result.StatusCode == http.StatusTooManyRequests,
+		result.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// backoffDelay returns the wait before retry number attempt+1: the
+// exponential delay capped at uploadMaxBackoff, with the upper half jittered
+func backoffDelay(attempt int) time.Duration {
+	delay := uploadBaseBackoff << attempt
+	if delay > uploadMaxBackoff || delay <= 0 {
+		delay = uploadMaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if when, err := http.ParseTime(value); err == nil {
+		delay = time.Until(when)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	if delay > uploadMaxRetryAfter {
+		return uploadMaxRetryAfter
+	}
+	return delay
+}
+
+// sendPayload makes a single upload attempt
+func (s *HTTPSink) sendPayload(entry *SpoolEntry) (*UploadResult, error) {
 	// Create multipart form
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
@@ -43,44 +337,52 @@ func uploadUsageData(config *Config) (*UploadResult, error) {
 	if err != nil {
 		return &UploadResult{Success: false, Message: err.Error()}, err
 	}
-	filePart.Write(jsonData)
+	filePart.Write(entry.Data)
 
 	// Add metadata fields
-	hostname, _ := os.Hostname()
-	writer.WriteField("hostname", hostname)
-	writer.WriteField("timestamp", fmt.Sprintf("%d", time.Now().Unix()))
-	writer.WriteField("userEmail", config.Email)
+	writer.WriteField("hostname", entry.Hostname)
+	writer.WriteField("timestamp", fmt.Sprintf("%d", entry.Timestamp))
+	writer.WriteField("userEmail", s.email)
 
 	writer.Close()
 
 	// Send request
-	uploadURL := config.ServerURL + "/api/claude-usage/upload"
-	req, err := http.NewRequest("POST", uploadURL, &buf)
+	uploadURL := s.serverURL + "/api/claude-usage/upload"
+	body := buf.Bytes()
+	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(body))
 	if err != nil {
 		return &UploadResult{Success: false, Message: err.Error()}, err
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	if err := authenticateRequest(req, body, s.apiToken, s.signingSecret); err != nil {
+		return &UploadResult{Success: false, Message: err.Error()}, err
+	}
+
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return &UploadResult{Success: false, Message: err.Error()}, err
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	respBody, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode == 200 || resp.StatusCode == 201 {
 		return &UploadResult{
 			Success:    true,
 			StatusCode: resp.StatusCode,
-			Message:    fmt.Sprintf("Uploaded %d days of data", len(usageData.Daily)),
+			Message:    fmt.Sprintf("Uploaded %d days of data", entry.DayCount),
 		}, nil
 	}
 
-	return &UploadResult{
+	result := &UploadResult{
 		Success:    false,
 		StatusCode: resp.StatusCode,
-		Message:    string(body),
-	}, fmt.Errorf("upload failed: HTTP %d", resp.StatusCode)
+		Message:    string(respBody),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		result.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	return result, fmt.Errorf("upload failed: HTTP %d", resp.StatusCode)
 }
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"absent", "", 0},
+		{"seconds", "120", 2 * time.Minute},
+		{"zero", "0", 0},
+		{"negative", "-5", 0},
+		{"capped", "86400", uploadMaxRetryAfter},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+		{"far date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), uploadMaxRetryAfter},
+		{"garbage", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	// A date is relative to now, and HTTP dates have whole seconds
+	date := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 88*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 90s", date, got)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 70; attempt++ {
+		// 2s, 4s, ... 32s, then capped, also where the shift overflows
+		ceiling := uploadMaxBackoff
+		if attempt < 5 {
+			ceiling = uploadBaseBackoff << attempt
+		}
+
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 20; i++ {
+			delay := backoffDelay(attempt)
+			if delay < ceiling/2 || delay > ceiling {
+				t.Fatalf("backoffDelay(%d) = %v, want between %v and %v", attempt, delay, ceiling/2, ceiling)
+			}
+			seen[delay] = true
+		}
+		if len(seen) == 1 {
+			t.Errorf("backoffDelay(%d) returned the same delay 20 times, want jitter", attempt)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{0, true},
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusNotFound, false},
+		{http.StatusRequestEntityTooLarge, false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryable(&UploadResult{StatusCode: tt.status}); got != tt.want {
+			t.Errorf("isRetryable(HTTP %d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+// usageServer is a stub usage server answering with the queued statuses,
+// then 200, and recording the first day of each upload
+type usageServer struct {
+	mu       sync.Mutex
+	statuses []int
+	days     []string
+}
+
+func (s *usageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(file)
+	var usageData UsageData
+	json.Unmarshal(data, &usageData)
+	if len(usageData.Daily) > 0 {
+		s.days = append(s.days, usageData.Daily[0].Date)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *usageServer) respond(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = statuses
+}
+
+func (s *usageServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.days...)
+}
+
+// newTestHTTPSink returns a sink uploading to a stub server, with its spool
+// in a temporary config directory
+func newTestHTTPSink(t *testing.T, config *Config) (*HTTPSink, *usageServer) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	server := &usageServer{}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	config.Email = "dev@example.com"
+	config.ServerURL = httpServer.URL
+	sink, err := newHTTPSink(config, SinkConfig{Name: "usage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink, server
+}
+
+func usageFor(date string) *UsageData {
+	return &UsageData{Daily: []DailyStats{{Date: date}}}
+}
+
+// TestHTTPSinkRetry checks that a 503 is retried after its Retry-After
+func TestHTTPSinkRetry(t *testing.T) {
+	sink, server := newTestHTTPSink(t, &Config{})
+	server.respond(http.StatusServiceUnavailable)
+
+	result, err := sink.Send(usageFor("2025-01-01"), nil)
+	if err != nil {
+		t.Fatalf("Send: %v (%+v)", err, result)
+	}
+	if got := server.received(); len(got) != 1 {
+		t.Errorf("server received %v, want one upload", got)
+	}
+	if pending, _ := sink.spool.list(); len(pending) != 0 {
+		t.Errorf("%d payloads spooled, want none", len(pending))
+	}
+}
+
+// TestHTTPSinkSpool checks that undelivered payloads are spooled, a newer
+// full payload replacing the older ones, and delivered in order later
+func TestHTTPSinkSpool(t *testing.T) {
+	sink, server := newTestHTTPSink(t, &Config{})
+
+	// A closed cancel gives up at the first failure instead of waiting
+	cancel := make(chan struct{})
+	close(cancel)
+
+	server.respond(http.StatusServiceUnavailable)
+	if _, err := sink.Send(usageFor("2025-01-01"), cancel); err == nil {
+		t.Fatal("Send succeeded while the server is down")
+	}
+	server.respond(http.StatusServiceUnavailable)
+	if _, err := sink.Send(usageFor("2025-01-02"), cancel); err == nil {
+		t.Fatal("Send succeeded while the server is down")
+	}
+	pending, _ := sink.spool.list()
+	if len(pending) != 1 {
+		t.Fatalf("%d full payloads spooled, want only the newest", len(pending))
+	}
+
+	// Partial payloads each hold other days, so they queue up behind it
+	partial := usageFor("2025-01-03")
+	partial.Partial = true
+	server.respond(http.StatusServiceUnavailable)
+	if _, err := sink.Send(partial, cancel); err == nil {
+		t.Fatal("Send succeeded while the server is down")
+	}
+
+	if _, err := sink.Send(usageFor("2025-01-04"), cancel); err != nil {
+		t.Fatalf("Send after recovery: %v", err)
+	}
+	want := []string{"2025-01-02", "2025-01-03", "2025-01-04"}
+	if got := server.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %v, want %v", got, want)
+	}
+	if pending, _ := sink.spool.list(); len(pending) != 0 {
+		t.Errorf("%d payloads left in the spool, want none", len(pending))
+	}
+}
+
+// TestFlushSpoolDropsRejected checks that a payload the server rejects is
+// dropped, while one that fails transiently stays queued
+func TestFlushSpoolDropsRejected(t *testing.T) {
+	sink, server := newTestHTTPSink(t, &Config{})
+	for _, date := range []string{"2025-01-01", "2025-01-02"} {
+		entry, err := sink.newSpoolEntry(usageFor(date))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.spool.add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server.respond(http.StatusServiceUnavailable)
+	if _, err := sink.flushSpool(nil); err == nil {
+		t.Error("flushSpool succeeded while the server is down")
+	}
+	if pending, _ := sink.spool.list(); len(pending) != 2 {
+		t.Fatalf("%d payloads spooled after a 503, want 2", len(pending))
+	}
+
+	server.respond(http.StatusBadRequest)
+	delivered, err := sink.flushSpool(nil)
+	if err != nil || delivered != 1 {
+		t.Errorf("flushSpool = %d, %v; want 1 delivered", delivered, err)
+	}
+	if got := server.received(); len(got) != 1 || got[0] != "2025-01-02" {
+		t.Errorf("server received %v, want only the second payload", got)
+	}
+	if pending, _ := sink.spool.list(); len(pending) != 0 {
+		t.Errorf("%d payloads left in the spool, want none", len(pending))
+	}
+}
+
+// TestSpoolTrim checks that the oldest payloads go first when the spool
+// is over its limits
+func TestSpoolTrim(t *testing.T) {
+	spool := &Spool{dir: t.TempDir(), maxFiles: 2, maxBytes: defaultSpoolMaxBytes}
+	for i := int64(1); i <= 3; i++ {
+		if err := spool.add(&SpoolEntry{Timestamp: i, Data: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, _ := spool.list()
+	if len(paths) != 2 {
+		t.Fatalf("%d payloads spooled, want 2", len(paths))
+	}
+	for i, path := range paths {
+		entry, err := spool.read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Timestamp != int64(i+2) {
+			t.Errorf("payload %d has timestamp %d, want %d", i, entry.Timestamp, i+2)
+		}
+	}
+
+	// One payload over the byte limit leaves nothing
+	spool.maxBytes = 1
+	if err := spool.add(&SpoolEntry{Timestamp: 4, Data: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if paths, _ := spool.list(); len(paths) != 0 {
+		t.Errorf("%d payloads spooled over the byte limit, want none", len(paths))
+	}
+}
+
+// TestHTTPSinkChangedSpool checks that in the "changed" mode days already
+// queued aren't queued again while the server is down, and that spooled
+// payloads are recorded in the ledger once delivered, so they aren't sent
+// again as changed
+func TestHTTPSinkChangedSpool(t *testing.T) {
+	sink, server := newTestHTTPSink(t, &Config{UploadMode: "changed"})
+	cancel := make(chan struct{})
+	close(cancel)
+
+	usage := func(tokens int64) *UsageData {
+		return &UsageData{Timezone: "UTC", Daily: []DailyStats{
+			{Date: "2025-01-01", TokenTotals: TokenTotals{TotalTokens: 10}},
+			{Date: "2025-01-02", TokenTotals: TokenTotals{TotalTokens: tokens}},
+		}}
+	}
+	sendWhileDown := func(usageData *UsageData) {
+		t.Helper()
+		server.respond(http.StatusServiceUnavailable)
+		if _, err := sink.Send(usageData, cancel); err == nil {
+			t.Fatal("Send succeeded while the server is down")
+		}
+	}
+	spooled := func() int {
+		pending, _ := sink.spool.list()
+		return len(pending)
+	}
+
+	sendWhileDown(usage(20))
+	sendWhileDown(usage(20))
+	if n := spooled(); n != 1 {
+		t.Errorf("%d payloads spooled for unchanged data, want the first full one only", n)
+	}
+	sendWhileDown(usage(25))
+	sendWhileDown(usage(25))
+	if n := spooled(); n != 2 {
+		t.Errorf("%d payloads spooled after one day changed, want 2", n)
+	}
+
+	result, err := sink.Send(usage(25), cancel)
+	if err != nil {
+		t.Fatalf("Send after recovery: %v", err)
+	}
+	if got := server.received(); len(got) != 2 {
+		t.Errorf("server received %d uploads, want the full and the changed payload", len(got))
+	}
+	if result.Message != "No changed days to upload" {
+		t.Errorf("result = %q, want nothing left to upload", result.Message)
+	}
+
+	ledger := loadUploadLedger(sink.name)
+	if ledger.Days["2025-01-02"] != dayDigest(usage(25).Daily[1]) {
+		t.Error("ledger doesn't have the changed day as delivered from the spool")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// How often files are checked when change notifications are unavailable
+	watchPollInterval = 2 * time.Second
+
+	// Quiet period after a change notification before files are read, so a
+	// burst of writes is handled at once
+	watchDebounce = 250 * time.Millisecond
+)
+
+// UsageWatcher keeps usage of the recent transcripts current in memory by
+// parsing lines as they are appended. It works on its own, without the
+// checkpoint, so the collection window of the daemon is left alone.
+type UsageWatcher struct {
+	claudeDir   string
+	windowStart time.Time
+
+	// What was parsed from each file, tracked as in the checkpoint but only
+	// in memory; messages is its message map
+	parsed      *Checkpoint
+	messages    map[string]*MessageDataEntry
+	diagnostics Diagnostics
+}
+
+func newUsageWatcher(windowStart time.Time) *UsageWatcher {
+	parsed := newCheckpoint()
+	return &UsageWatcher{
+		claudeDir:   getClaudeProjectsDir(),
+		windowStart: windowStart,
+		parsed:      parsed,
+		messages:    parsed.Messages,
+	}
+}
+
+// scan parses whatever was appended to the transcripts since the last scan
+// and reports whether anything was read
+func (w *UsageWatcher) scan() bool {
+	updated := false
+
+	filepath.Walk(w.claudeDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			w.diagnostics.fileError(path, err)
+			return nil // Skip errors
+		}
+		if info.IsDir() || filepath.Ext(path) != ".jsonl" {
+			return nil
+		}
+		w.diagnostics.FilesScanned++
+
+		// Files last written before the window can't hold messages in it
+		if info.ModTime().Before(w.windowStart) {
+			return nil
+		}
+
+		fileCheckpoint := w.parsed.Files[path]
+		if fileCheckpoint.isUnchanged(info) {
+			return nil
+		}
+
+		offset := fileCheckpoint.resumeOffset(info)
+		if offset == 0 && fileCheckpoint != nil {
+			// Truncated or replaced: forget what was parsed from it and start over
+			w.parsed.dropFile(path)
+			updated = true
+		}
+
+		fileData := make(map[string]*MessageDataEntry)
+		newOffset, err := processJSONLFile(path, projectFromPath(w.claudeDir, path), offset, fileData, w.windowStart, &w.diagnostics)
+		for key, entry := range fileData {
+			if previous, ok := w.messages[key]; ok && previous.File != entry.File {
+				w.diagnostics.DuplicateMessages++
+				w.parsed.addHolders(key, previous.File, entry.File)
+			}
+			w.messages[key] = entry
+		}
+		if err != nil {
+			w.diagnostics.fileError(path, err)
+			return nil
+		}
+		w.diagnostics.FilesParsed++
+		w.parsed.Files[path] = &FileCheckpoint{
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+			Inode:   fileInode(info),
+			Offset:  newOffset,
+		}
+		updated = true
+		return nil
+	})
+
+	return updated
+}
+
+// handleWatch shows usage of the current session, block and day, updated as
+// Claude Code writes its transcripts
+func handleWatch() {
+	config := loadConfigOrDefault()
+
+	pricing, err := loadPricing(config.PricingFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	loc, err := config.getLocation()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Yesterday is included so a session or block that started before
+	// midnight is complete
+	now := time.Now().In(loc)
+	watcher := newUsageWatcher(time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, loc))
+	watcher.scan()
+
+	changed := make(chan struct{}, 1)
+	mode := "inotify"
+	var poll <-chan time.Time
+	if err := watchDirectory(watcher.claudeDir, changed); err != nil {
+		mode = fmt.Sprintf("polling every %s", watchPollInterval)
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// Redraw every second so the time until reset keeps counting down
+	redraw := time.NewTicker(time.Second)
+	defer redraw.Stop()
+
+	interactive := isatty(os.Stdout.Fd())
+	renderWatch(watcher, pricing, loc, mode, interactive)
+
+	for {
+		select {
+		case <-changed:
+			time.Sleep(watchDebounce)
+			select {
+			case <-changed:
+			default:
+			}
+			if watcher.scan() {
+				renderWatch(watcher, pricing, loc, mode, interactive)
+			}
+		case <-poll:
+			if watcher.scan() {
+				renderWatch(watcher, pricing, loc, mode, interactive)
+			}
+		case <-redraw.C:
+			// Without a terminal only changes are printed
+			if interactive {
+				renderWatch(watcher, pricing, loc, mode, interactive)
+			}
+		case <-sigChan:
+			fmt.Println()
+			return
+		}
+	}
+}
+
+// renderWatch draws the live view; without a terminal it prints one line
+// per update instead
+func renderWatch(watcher *UsageWatcher, pricing PricingTable, loc *time.Location, mode string, interactive bool) {
+	now := time.Now()
+	today := now.In(loc).Format("2006-01-02")
+
+	// The session of the most recent message is the current one
+	var latest *MessageDataEntry
+	for _, data := range watcher.messages {
+		if latest == nil || data.Timestamp.After(latest.Timestamp) {
+			latest = data
+		}
+	}
+
+	var session, day TokenTotals
+	dayModels := make(map[string]*ModelStats)
+	for _, data := range watcher.messages {
+		cost := pricing.cost(data.Model, data.Usage)
+		if latest != nil && data.Session == latest.Session {
+			session.add(data.Usage, cost)
+		}
+		if data.Timestamp.In(loc).Format("2006-01-02") == today {
+			day.add(data.Usage, cost)
+
+			model := data.Model
+			if model == "" {
+				model = unknownModel
+			}
+			getModelStats(dayModels, model).add(data.Usage, cost)
+		}
+	}
+
+	var block *SessionBlock
+	blocks := aggregateBlocks(watcher.messages, pricing, loc, now)
+	for i := range blocks {
+		if blocks[i].Active {
+			block = &blocks[i]
+		}
+	}
+
+	if !interactive {
+		line := fmt.Sprintf("%s today=%s", now.In(loc).Format("2006-01-02 15:04:05"), formatCount(day.TotalTokens))
+		if latest != nil {
+			line += fmt.Sprintf(" session=%s", formatCount(session.TotalTokens))
+		}
+		if block != nil {
+			line += fmt.Sprintf(" block=%s resets_in=%s", formatCount(block.TotalTokens), formatDuration(block.end.Sub(now)))
+		}
+		fmt.Println(line)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "Claude Code usage  %s  (%s)\n\n", now.In(loc).Format("2006-01-02 15:04:05"), mode)
+
+	if latest != nil {
+		project := latest.Project
+		if latest.Cwd != "" {
+			project = latest.Cwd
+		}
+		fmt.Fprintf(&b, "Current session: %s\n", latest.Session)
+		fmt.Fprintf(&b, "  Project: %s\n", project)
+		fmt.Fprintf(&b, "  Last message: %s (%s)\n", latest.Timestamp.In(loc).Format("15:04:05"), latest.Model)
+		writeWatchTotals(&b, session)
+	} else {
+		b.WriteString("Current session: none yet\n")
+	}
+
+	b.WriteString("\n")
+	if block != nil {
+		fmt.Fprintf(&b, "5-hour block: %s - %s (resets in %s)\n",
+			block.start.In(loc).Format("15:04"), block.end.In(loc).Format("15:04"), formatDuration(block.end.Sub(now)))
+		writeWatchTotals(&b, block.TokenTotals)
+	} else {
+		b.WriteString("5-hour block: none active\n")
+	}
+
+	fmt.Fprintf(&b, "\nToday (%s):\n", today)
+	writeWatchTotals(&b, day)
+	models := sortedModelStats(dayModels)
+	sort.SliceStable(models, func(i, j int) bool {
+		return models[i].TotalTokens > models[j].TotalTokens
+	})
+	for _, model := range models {
+		fmt.Fprintf(&b, "    %-28s %14s  $%.2f\n", model.Model, formatCount(model.TotalTokens), model.EstimatedCostUSD)
+	}
+
+	if skipped := watcher.diagnostics.skippedLines(); skipped > 0 {
+		fmt.Fprintf(&b, "\nSkipped %d unusable transcript lines\n", skipped)
+	}
+
+	b.WriteString("\nPress Ctrl+C to exit\n")
+	fmt.Print(b.String())
+}
+
+func writeWatchTotals(b *strings.Builder, totals TokenTotals) {
+	fmt.Fprintf(b, "  Tokens: %s (input %s, output %s, cache write %s, cache read %s)\n",
+		formatCount(totals.TotalTokens),
+		formatCount(totals.TotalInputTokens),
+		formatCount(totals.TotalOutputTokens),
+		formatCount(totals.TotalCacheWriteTokens),
+		formatCount(totals.TotalCacheReadTokens))
+	fmt.Fprintf(b, "  Requests: %d  Estimated cost: $%.2f\n", totals.RequestCount, totals.EstimatedCostUSD)
+}
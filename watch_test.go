@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestUsageWatcherRewrite checks that the watcher forgets what it parsed
+// from a file that was truncated or replaced, but keeps messages another
+// file still holds
+func TestUsageWatcherRewrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite func(t *testing.T, path string, lines []string)
+	}{
+		{"truncated", func(t *testing.T, path string, lines []string) {
+			writeTranscript(t, path, lines)
+		}},
+		{"replaced", func(t *testing.T, path string, lines []string) {
+			writeTranscript(t, path+".tmp", lines)
+			if err := os.Rename(path+".tmp", path); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := setupCollection(t)
+			timestamp := time.Now().UTC().Format(time.RFC3339)
+			path := filepath.Join(project, "session.jsonl")
+			other := filepath.Join(project, "other.jsonl")
+
+			writeTranscript(t, other, []string{assistantLine("shared", timestamp, 1)})
+			writeTranscript(t, path, []string{
+				assistantLine("shared", timestamp, 1),
+				assistantLine("old1", timestamp, 1),
+				assistantLine("old2", timestamp, 2),
+			})
+			watcher := newUsageWatcher(time.Now().Add(-24 * time.Hour))
+			watcher.scan()
+			if got := messageKeys(watcher.messages); got != "old1,old2,shared" {
+				t.Fatalf("first scan: messages %s", got)
+			}
+
+			tt.rewrite(t, path, []string{assistantLine("new", timestamp, 5)})
+			if !watcher.scan() {
+				t.Error("scan reported no change")
+			}
+			if got := messageKeys(watcher.messages); got != "new,shared" {
+				t.Errorf("after the rewrite: messages %s, want new,shared", got)
+			}
+		})
+	}
+}
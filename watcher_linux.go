@@ -0,0 +1,90 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE | syscall.IN_DELETE_SELF
+
+// watchDirectory signals on changed whenever a file below root is written,
+// created or removed. Watches are added for subdirectories created later.
+// It runs until the process exits.
+func watchDirectory(root string, changed chan<- struct{}) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+
+	// Only touched by the caller until the reader goroutine takes over
+	dirs := make(map[int32]string)
+	addTree := func(dir string) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			// Unreadable subdirectories are skipped, but without a watch on
+			// dir itself nothing would ever be signaled
+			if err != nil {
+				if path == dir {
+					return err
+				}
+				return nil
+			}
+			if !info.IsDir() {
+				if path == dir {
+					return fmt.Errorf("%s is not a directory", dir)
+				}
+				return nil
+			}
+			wd, err := syscall.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				return err
+			}
+			dirs[int32(wd)] = path
+			return nil
+		})
+	}
+
+	if err := addTree(root); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil || n <= 0 {
+				return
+			}
+
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+				// New project directories need their own watch
+				if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					addTree(filepath.Join(dirs[event.Wd], strings.TrimRight(string(nameBytes), "\x00")))
+				}
+			}
+
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return nil
+}
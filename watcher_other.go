@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// watchDirectory is only implemented with inotify; other platforms poll
+func watchDirectory(root string, changed chan<- struct{}) error {
+	return errors.New("file notifications are not supported on this platform")
+}